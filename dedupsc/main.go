@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -13,56 +15,131 @@ import (
 )
 
 func main() {
+	// `dedupsc watch [flags]` keeps watching the paths for new duplicates after the search.
+	args := os.Args[1:]
+	watching := len(args) > 0 && args[0] == "watch"
+	if watching {
+		args = args[1:]
+	}
+
 	cfg := dupescout.Cfg{}
-	cfg.KeyGenerator = keyGeneratorSelect()
+	cfg.KeyGenerator, cfg.CacheNamespace = keyGeneratorSelect()
 	flag.Var(&cfg.Paths, "p", "paths to search for duplicates")
+	flag.Var(&cfg.References, "r", "reference paths whose files are kept, only duplicates of them in -p are listed")
+	flag.BoolVar(&cfg.CrossRoots, "xr", false, "only list duplicates found in at least two different paths")
 	flag.BoolVar(&cfg.SkipSubdirs, "sd", false, "skip directories traversal")
 	flag.BoolVar(&cfg.HiddenInclude, "ih", false, "ignore hidden files and directories")
+	flag.BoolVar(&cfg.FollowSymlinks, "fs", false, "follow symlinks to files and directories")
 	flag.Var(&cfg.ExtInclude, "ie", "extensions to include")
 	flag.Var(&cfg.ExtExclude, "ee", "extensions to exclude")
 	flag.Var(&cfg.DirsExclude, "ed", "directories or subdirectories to exclude")
-	flag.IntVar(&cfg.Workers, "w", 0, "number of workers (defaults to GOMAXPROCS)")
+	flag.Var(&cfg.GlobInclude, "ig", "glob pattern of the files to include, relative to each path (e.g. '**/Season */*.mkv', repeatable)")
+	flag.Var(&cfg.GlobExclude, "eg", "glob pattern of the files and directories to exclude, relative to each path (e.g. 'Movies/**/Extras', repeatable)")
+	flag.BoolVar(&cfg.OneFileSystem, "x", false, "stay on the filesystem of each path")
+	flag.Var(&cfg.PathRegexInclude, "ir", "regular expression of the file paths to include (repeatable)")
+	flag.Var(&cfg.PathRegexExclude, "er", "regular expression of the file and directory paths to exclude (e.g. '-sample\\.mkv$', repeatable)")
+	flag.Var(&cfg.FsTypesInclude, "ift", "filesystem types to include")
+	flag.Var(&cfg.FsTypesExclude, "eft", "filesystem types to exclude (e.g. nfs, cifs, fuse.sshfs)")
+	flag.Var(&cfg.MinSize, "min", "minimum size of the files to search (e.g. 100MiB)")
+	flag.Var(&cfg.MaxSize, "max", "maximum size of the files to search (e.g. 4GiB)")
+	flag.IntVar(&cfg.Workers, "w", 0, "number of workers generating keys across all devices (defaults to GOMAXPROCS/2)")
+	flag.IntVar(&cfg.DeviceWorkers, "wd", 0, "number of workers generating keys per device (defaults to -w)")
+	flag.IntVar(&cfg.RotationalReaders, "wr", 0, "number of workers generating keys per rotational disk (defaults to 1)")
+	flag.IntVar(&cfg.Walkers, "ww", 0, "number of directories read concurrently (defaults to 8)")
+	flag.BoolVar(&cfg.Staged, "st", false, "group files by size and partial hash before generating keys")
+	flag.BoolVar(&cfg.Verify, "vb", false, "verify duplicates byte by byte before listing them")
 	logPaths := flag.Bool("l", false, "duplicate results will be logged to stdout")
-	flag.Parse()
+	cachePath := flag.String("c", "", "cache file to reuse the keys of unchanged files (disabled if empty)")
+	snapshotPath := flag.String("s", "", "snapshot file of the previous search, to only read new and modified files and mark new groups (disabled if empty)")
+	memoryLimit := flag.Int64("ml", 0, "memory limit in MiB of the file index, spilling to disk past it (0 for no limit)")
+	flag.CommandLine.Parse(args)
+	cfg.MemoryLimit = *memoryLimit << 20
+
+	if *cachePath != "" {
+		cache, err := dupescout.OpenCache(*cachePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Cache = cache
+	}
 
-	// When logging, loading spinner is redundant.
-	var done chan struct{}
+	if *snapshotPath != "" {
+		snapshot, err := dupescout.OpenSnapshot(*snapshotPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Snapshot = snapshot
+	}
+
+	// When logging, the progress bar would get in the way of the logged paths.
 	if !*logPaths {
-		done = make(chan struct{})
-		go loadingSpinner(done)
+		cfg.Progress = progressPrinter()
+		cfg.ProgressInterval = 150 * time.Millisecond
+	}
+
+	// Stop the search gracefully on SIGINT or SIGTERM, keeping the duplicates found so far.
+	ctx, stop := dupescout.ShutdownOnSignal(context.Background())
+	defer stop()
+
+	if watching {
+		watch(ctx, cfg)
+		saveState(cfg)
+		return
 	}
 
-	dupes := []string{}
-	dupesChan := make(chan []string, 10)
+	dupes := []dupescout.File{}
+	options := []string{}
+	updates := make(chan dupescout.GroupUpdate, 10)
 
 	// Start the duplicate search in its own goroutine.
-	go func(cfg dupescout.Cfg, dupesChan chan []string) {
-		err := dupescout.StreamResults(cfg, dupesChan)
+	go func(cfg dupescout.Cfg, updates chan dupescout.GroupUpdate) {
+		err := dupescout.StreamGroupsContext(ctx, cfg, updates)
 		if err != nil {
 			log.Println(err)
 		}
-	}(cfg, dupesChan)
-
-	// Append a human readable size to each received duplicate path.
-	for dupePaths := range dupesChan {
-		for _, path := range dupePaths {
-			fi, err := os.Stat(path)
-			if err != nil {
-				log.Println(err)
-				continue
+	}(cfg, updates)
+
+	// Append a human readable size to each received duplicate path, the reference it
+	// duplicates if any, and mark the ones of groups that weren't found by the search
+	// of the snapshot.
+	newGroups := map[int]bool{}
+	references := map[int]string{}
+	for u := range updates {
+		if u.Deduplicated() {
+			continue
+		}
+
+		if u.New {
+			newGroups[u.Group] = true
+		}
+
+		for _, f := range u.Files {
+			if _, ok := references[u.Group]; !ok && f.Reference {
+				references[u.Group] = f.Path
+			}
+		}
+
+		for _, f := range u.Files {
+			if f.Reference {
+				continue // Never offered for deletion.
+			}
+
+			s := fmt.Sprintf("%s (%s)", f.Path, humanReadableSize(f.Size))
+			if ref, ok := references[u.Group]; ok {
+				s += fmt.Sprintf(" duplicates %s", ref)
+			}
+			if newGroups[u.Group] {
+				s += " [new]"
 			}
-			s := fmt.Sprintf("%s (%s)", path, humanReadableSize(fi.Size()))
 			if *logPaths {
 				fmt.Println(s)
 			}
-			dupes = append(dupes, s)
+			dupes = append(dupes, f)
+			options = append(options, s)
 		}
 	}
 
-	// Close done channel right after all duplicates have been found.
-	if done != nil {
-		close(done)
-	}
+	saveState(cfg)
 
 	if len(dupes) == 0 {
 		fmt.Printf("\nNo duplicates found with the provided configuration: %s\n", cfg.String())
@@ -71,19 +148,19 @@ func main() {
 
 	prompt := &survey.MultiSelect{
 		Message:  "Delete selected files:",
-		Options:  dupes,
+		Options:  options,
 		PageSize: 10,
 	}
 
-	selectedDupes := []string{}
-	err := survey.AskOne(prompt, &selectedDupes)
+	// Options map to the duplicates by index, so paths are never parsed back from the labels.
+	selected := []int{}
+	err := survey.AskOne(prompt, &selected)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sizeSuffixRegex := regexp.MustCompile(` \(.+\)$`)
-	for _, path := range selectedDupes {
-		path = sizeSuffixRegex.ReplaceAllString(path, "")
+	for _, i := range selected {
+		path := dupes[i].Path
 		err := os.Remove(path)
 		if err != nil {
 			log.Fatal(err)
@@ -92,39 +169,106 @@ func main() {
 	}
 }
 
+// Persists the cache and snapshot of the provided Cfg, if any.
+func saveState(cfg dupescout.Cfg) {
+	// Drop the keys of files that changed or no longer exist.
+	if cfg.Cache != nil {
+		cfg.Cache.Prune()
+		if err := cfg.Cache.Save(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if cfg.Snapshot != nil {
+		if err := cfg.Snapshot.Save(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Searches for duplicates, then prints files that turn out to be duplicates as they are
+// written to or moved into the searched paths, until the provided context is cancelled.
+func watch(ctx context.Context, cfg dupescout.Cfg) {
+	groups, events, err := dupescout.Watch(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Found %d groups of duplicates, watching for new ones...\n", len(groups))
+
+	for ev := range events {
+		switch ev.Kind {
+		case dupescout.WatchFailed:
+			log.Println(ev.Err)
+			continue
+		case dupescout.GroupFormed:
+			fmt.Printf("New group %d: %s (%s)\n", ev.Group, ev.File.Path, humanReadableSize(ev.File.Size))
+		case dupescout.FileJoined:
+			fmt.Printf("Joined group %d: %s (%s)\n", ev.Group, ev.File.Path, humanReadableSize(ev.File.Size))
+		}
+
+		for _, f := range ev.Files {
+			switch {
+			case f.Path == ev.File.Path:
+			case f.Reference:
+				fmt.Printf("  duplicate of %s (reference)\n", f.Path)
+			default:
+				fmt.Printf("  duplicate of %s\n", f.Path)
+			}
+		}
+	}
+}
+
 var earthSpinner = []string{"🌍", "🌎", "🌏"}
 
-func loadingSpinner(done <-chan struct{}) {
+// Returns a progress hook that keeps printing the progress of the search on the same line,
+// with the spinner advancing on each call.
+func progressPrinter() func(dupescout.Progress) {
 	i := 0
 	l := len(earthSpinner)
 
-	// Return when done channel is closed, otherwise keep spinning.
-	for {
-		select {
-		case <-done:
-			return
-		default:
-			fmt.Printf("\rScanning... %s", earthSpinner[i])
-			i = (i + 1) % l
-			time.Sleep(150 * time.Millisecond)
+	return func(p dupescout.Progress) {
+		fmt.Printf("\r%s %s\033[K", earthSpinner[i], progressLine(p))
+		i = (i + 1) % l
+
+		if p.Done {
+			fmt.Println()
 		}
 	}
 }
 
-func humanReadableSize(size int64) string {
-	const unit = 1024
-	if size < unit {
-		return fmt.Sprintf("%d B", size)
+// Formats the provided progress, with a progress bar and ETA once all files have been found
+// and queued.
+func progressLine(p dupescout.Progress) string {
+	switch p.Stage {
+	case dupescout.StageWalk:
+		return fmt.Sprintf("Scanning... %d files found (%s), %d hashed, %d groups",
+			p.FilesFound, humanReadableSize(p.BytesFound), p.FilesHashed, p.Groups)
+	case dupescout.StagePartial:
+		return fmt.Sprintf("Comparing sizes... %d files found (%s), %d/%d partially hashed, %s/s",
+			p.FilesFound, humanReadableSize(p.BytesFound), p.PartialHashed, p.PartialQueued, humanReadableSize(int64(p.Throughput)))
 	}
 
-	// Calculate the divisor and exponent of the unit symbol to use (KiB, MiB, GiB, etc).
-	div, exp := int64(unit), 0
-	for n := size / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	percent := 100.0
+	if p.BytesQueued > 0 {
+		percent = float64(p.BytesHashed) / float64(p.BytesQueued) * 100
+	}
+
+	const width = 20
+	filled := min(int(percent/100*width), width)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+
+	eta := "-"
+	if d := p.ETA(); d > 0 {
+		eta = d.Round(time.Second).String()
 	}
 
-	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+	return fmt.Sprintf("[%s] %5.1f%% %d/%d files, %s/s, ETA %s, %d groups",
+		bar, percent, p.FilesHashed, p.FilesQueued, humanReadableSize(int64(p.Throughput)), eta, p.Groups)
+}
+
+func humanReadableSize(size int64) string {
+	return dupescout.Size(size).String()
 }
 
 type keyGeneratorPair struct {
@@ -141,6 +285,14 @@ var keygenMap = map[string]keyGeneratorPair{
 		description: "Groups video files together based on their audio codec.",
 		fn:          audioCodecKeyGenerator(""), // custom key generator function (closure)
 	},
+	"HashKeyGenerator": {
+		description: "Hashes the file contents with a selectable algorithm (crc64, fnv128a, md5, sha1, sha512, etc).",
+		fn:          dupescout.NewHashKeyGenerator(dupescout.HashFuncs["sha512"], dupescout.HashOptions{}),
+	},
+	"SampledKeyGenerator": {
+		description: "Combines the file size with a sha256 hash of chunks sampled across the file. Fast and accurate for large files.",
+		fn:          dupescout.SampledKeyGenerator,
+	},
 	"Crc32HashKeyGenerator": {
 		description: "Generates a crc32 hash of the first 16KB of the file contents.",
 		fn:          dupescout.Crc32HashKeyGenerator,
@@ -159,8 +311,9 @@ var keygenMap = map[string]keyGeneratorPair{
 	},
 }
 
-// Prompts the user to select a key generator function and returns it.
-func keyGeneratorSelect() dupescout.KeyGeneratorFunc {
+// Prompts the user to select a key generator function and returns it along with
+// the cache namespace of its keys, which is empty if the default can be used.
+func keyGeneratorSelect() (dupescout.KeyGeneratorFunc, string) {
 	var keygenFnNames []string
 	for fnName := range keygenMap {
 		keygenFnNames = append(keygenFnNames, fnName)
@@ -192,8 +345,54 @@ func keyGeneratorSelect() dupescout.KeyGeneratorFunc {
 			log.Fatal(err)
 		}
 		// Return a closure that returns a KeyGeneratorFunc with the provided audio codec.
-		return audioCodecKeyGenerator(audioCodec)
+		// Keys depend on the audio codec, so each one gets its own cache namespace.
+		return audioCodecKeyGenerator(audioCodec), keygenFnName + "-" + audioCodec
+	}
+
+	if keygenFnName == "HashKeyGenerator" {
+		return hashKeyGeneratorSelect()
+	}
+
+	return keygenMap[keygenFnName].fn, ""
+}
+
+// Prompts the user to select the hash algorithm and how much of each file to hash,
+// and returns the resulting key generator along with its cache namespace.
+func hashKeyGeneratorSelect() (dupescout.KeyGeneratorFunc, string) {
+	var algorithms []string
+	for name := range dupescout.HashFuncs {
+		algorithms = append(algorithms, name)
+	}
+	sort.Strings(algorithms)
+
+	var algorithm string
+	err := survey.AskOne(&survey.Select{
+		Message: "Select a hash algorithm:",
+		Options: algorithms,
+		Default: "sha512",
+	}, &algorithm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var full bool
+	err = survey.AskOne(&survey.Confirm{
+		Message: "Hash the entire file contents?",
+		Help:    fmt.Sprintf("Only the first %s of each file are hashed otherwise.", humanReadableSize(dupescout.DefaultHashPrefixSize)),
+	}, &full)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := dupescout.HashOptions{Full: full}
+	fn := dupescout.NewHashKeyGenerator(dupescout.HashFuncs[algorithm], opts)
+
+	// All hash key generators share the same function name, so each algorithm and
+	// prefix combination gets its own cache namespace.
+	namespace := "HashKeyGenerator-" + algorithm
+	if full {
+		namespace += "-full"
 	}
 
-	return keygenMap[keygenFnName].fn
+	return fn, namespace
 }
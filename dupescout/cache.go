@@ -0,0 +1,213 @@
+package dupescout
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Bumped whenever the on-disk format of the cache changes, older caches are discarded.
+const cacheVersion = 1
+
+// A cached key, which is only valid as long as the file it was generated for is unchanged.
+type cacheEntry struct {
+	Dev     uint64
+	Inode   uint64
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+	Key     string
+}
+
+// Reports whether the entry was generated for the provided file as it is now.
+func (e cacheEntry) matches(f File) bool {
+	return e.Dev == f.Dev && e.Inode == f.Inode && e.Size == f.Size && e.ModTime == f.ModTime.UnixNano()
+}
+
+// On-disk representation of the cache.
+type cacheFile struct {
+	Version    int
+	Namespaces map[string]map[string]cacheEntry // namespace -> path -> entry
+}
+
+// Cache persists the keys generated by a KeyGeneratorFunc, so that unchanged files
+// don't need to be read again on the next search.
+//
+// A file is considered unchanged when its device, inode, size and modification time
+// are the same as when its key was generated. Keys are stored per namespace, which
+// defaults to the name of the KeyGeneratorFunc (see Cfg.CacheNamespace).
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mu         sync.RWMutex
+	path       string
+	namespaces map[string]map[string]cacheEntry
+}
+
+// Opens the cache stored at the provided path, an empty cache is returned if the
+// file doesn't exist yet or was written by an incompatible version.
+//
+// Changes are only persisted when calling Save.
+func OpenCache(path string) (*Cache, error) {
+	path, err := sanitizePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{path: path, namespaces: map[string]map[string]cacheEntry{}}
+
+	file, err := os.Open(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cf cacheFile
+	if err := gob.NewDecoder(file).Decode(&cf); err != nil {
+		return nil, fmt.Errorf("decoding cache %s: %w", c.path, err)
+	}
+
+	if cf.Version == cacheVersion && cf.Namespaces != nil {
+		c.namespaces = cf.Namespaces
+	}
+
+	return c, nil
+}
+
+// Writes the cache to its path, replacing the previous file atomically.
+func (c *Cache) Save() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return writeGobAtomic(c.path, cacheFile{Version: cacheVersion, Namespaces: c.namespaces})
+}
+
+// Encodes the provided value to the provided path, writing to a temporary file in the
+// same directory first and renaming it, so that the previous file is replaced atomically.
+func writeGobAtomic(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Removes the cached keys of the provided paths in all namespaces.
+func (c *Cache) Invalidate(paths ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entries := range c.namespaces {
+		for _, path := range paths {
+			delete(entries, path)
+		}
+	}
+}
+
+// Removes all cached keys of the provided namespace, or of all namespaces if empty.
+func (c *Cache) Clear(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if namespace == "" {
+		c.namespaces = map[string]map[string]cacheEntry{}
+		return
+	}
+
+	delete(c.namespaces, namespace)
+}
+
+// Removes the cached keys of files that were deleted or changed since their key was
+// generated, and returns the number of removed entries.
+func (c *Cache) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Stat every path only once, even if it's cached in multiple namespaces. Followed symlinks
+	// are cached under their own path with the info of their target, so they are stat'ed the same way.
+	current := map[string]*File{}
+	pruned := 0
+
+	for _, entries := range c.namespaces {
+		for path, entry := range entries {
+			f, ok := current[path]
+			if !ok {
+				if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+					file := newFile(path, fi)
+					f = &file
+				}
+				current[path] = f
+			}
+
+			if f == nil || !entry.matches(*f) {
+				delete(entries, path)
+				pruned++
+			}
+		}
+	}
+
+	return pruned
+}
+
+// Returns the number of cached keys in the provided namespace.
+func (c *Cache) Len(namespace string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.namespaces[namespace])
+}
+
+// Returns the cached key of the provided file if it is unchanged, otherwise generates
+// the key with the provided function and caches it.
+//
+// A nil cache always generates the key.
+func (c *Cache) key(namespace string, f File, generatorFn func(File) (string, error)) (string, error) {
+	if c == nil {
+		return generatorFn(f)
+	}
+
+	c.mu.RLock()
+	entry, ok := c.namespaces[namespace][f.Path]
+	c.mu.RUnlock()
+
+	if ok && entry.matches(f) {
+		return entry.Key, nil
+	}
+
+	key, err := generatorFn(f)
+	if err != nil || key == "" {
+		return key, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, ok := c.namespaces[namespace]
+	if !ok {
+		entries = map[string]cacheEntry{}
+		c.namespaces[namespace] = entries
+	}
+	entries[f.Path] = cacheEntry{f.Dev, f.Inode, f.Size, f.ModTime.UnixNano(), key}
+
+	return key, nil
+}
@@ -0,0 +1,140 @@
+package dupescout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Helper to create a File from the provided path as it is on disk now.
+func statFile(t *testing.T, path string) File {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newFile(path, fi)
+}
+
+func TestCacheKey(t *testing.T) {
+	file, clean := createTempFile("Hello, World!")
+	defer clean()
+
+	calls := 0
+	keygen := func(f File) (string, error) {
+		calls++
+		return Crc32HashKeyGenerator(f.Path)
+	}
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := statFile(t, file.Name())
+	key1, _ := cache.key("crc32", f, keygen)
+	key2, _ := cache.key("crc32", f, keygen)
+
+	if key1 != key2 || calls != 1 {
+		t.Errorf("Expected cached key to be reused, got %d calls", calls)
+	}
+
+	// Another namespace must never reuse the keys of the first one.
+	if _, err := cache.key("sha256", f, keygen); err != nil || calls != 2 {
+		t.Errorf("Expected key to be generated for a new namespace, got %d calls", calls)
+	}
+
+	// Changing the modification time invalidates the cached key.
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file.Name(), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.key("crc32", statFile(t, file.Name()), keygen); err != nil || calls != 3 {
+		t.Errorf("Expected key to be generated for a changed file, got %d calls", calls)
+	}
+
+	cache.Invalidate(file.Name())
+
+	if cache.Len("crc32") != 0 || cache.Len("sha256") != 0 {
+		t.Error("Expected invalidated path to be removed from all namespaces")
+	}
+}
+
+func TestCacheSaveAndPrune(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Go rocks!",
+	})
+	cachePath := filepath.Join(dir, "cache", "keys")
+
+	cache, err := OpenCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := cache.key("crc32", statFile(t, filepath.Join(dir, name)), func(f File) (string, error) { return Crc32HashKeyGenerator(f.Path) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = OpenCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.Len("crc32") != 2 {
+		t.Fatalf("Expected 2 cached keys after reopening, got %d", cache.Len("crc32"))
+	}
+
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned := cache.Prune(); pruned != 1 || cache.Len("crc32") != 1 {
+		t.Errorf("Expected 1 pruned key and 1 remaining, got %d and %d", pruned, cache.Len("crc32"))
+	}
+
+	cache.Clear("")
+
+	if cache.Len("crc32") != 0 {
+		t.Error("Expected cache to be empty after clearing")
+	}
+}
+
+func TestCachePruneSymlinks(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"media/a.txt": "Hello, World!",
+		"other/b.txt": "Go rocks!",
+	})
+	media := filepath.Join(dir, "media")
+	if err := os.Symlink(filepath.Join(dir, "other", "b.txt"), filepath.Join(media, "link-b.txt")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	cache, err := OpenCache(filepath.Join(dir, "cache", "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Cfg{Paths: []string{media}, Cache: cache, CacheNamespace: "crc32"}
+	cfg.FollowSymlinks = true
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.Len("crc32") != 2 {
+		t.Fatalf("Expected 2 cached keys, got %d", cache.Len("crc32"))
+	}
+
+	// The key of the followed symlink is still valid, since its target is unchanged.
+	if pruned := cache.Prune(); pruned != 0 || cache.Len("crc32") != 2 {
+		t.Errorf("Expected no pruned keys and 2 remaining, got %d and %d", pruned, cache.Len("crc32"))
+	}
+}
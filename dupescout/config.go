@@ -1,14 +1,16 @@
 package dupescout
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/user"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
+	"time"
 )
 
 // Satisfies the flag.Value interface, string values can be provided as a csv or space separated list.
@@ -30,33 +32,113 @@ func (p *Paths) Set(val string) error {
 
 type Cfg struct {
 	KeyGenerator KeyGeneratorFunc // Function to generate a key based on the file path.
-	Paths                         // List of paths to search in for duplicates.
+	Paths                         // List of paths to search in for duplicates, resolved and merged when nested (see ErrOverlappingPaths).
 	Filters                       // Filters to apply when searching for duplicates.
-	Workers      int              // Number of workers to use when searching for duplicates.
+	Workers      int              // Number of workers generating keys across all devices, defaults to GOMAXPROCS/2 but at least 1.
+	Walkers      int              // Number of directories read concurrently, defaults to DefaultWalkers.
+	Staged       bool             // Group files by size and partial hash first, so that only possible duplicates get their key generated.
+	Verify       bool             // Compare files with the same key byte by byte, so that only true duplicates are reported.
+	Cache        *Cache           // Cache to reuse the keys of unchanged files from previous searches.
+
+	// Paths holding the files to keep, e.g. a canonical library, which are searched like Paths.
+	//
+	// When set, only groups with files of both References and Paths are reported, so that each
+	// group holds the candidates of Paths along with the reference files they duplicate, which
+	// have File.Reference set. Files of References are never returned by GetResults.
+	// References overlapping with Paths fail the search with ErrOverlappingPaths.
+	References Paths
+
+	// Only report groups with files found in at least two different entries of Paths (or
+	// References), e.g. files copied across disks, leaving out duplicates within a single
+	// path. The entry each file was found in is recorded in File.Root.
+	CrossRoots bool
+
+	// Snapshot of the previous search of the same paths, whose keys are reused for unchanged
+	// files. Holds the results of this search once it completes, see Snapshot.
+	Snapshot *Snapshot
+
+	// Namespace of the cached keys and snapshots, defaults to the name of the KeyGenerator function.
+	//
+	// Must be set when the KeyGenerator is a closure (e.g. from NewHashKeyGenerator), since all
+	// closures created by the same function share the same name, otherwise the search fails with
+	// ErrCacheNamespace.
+	CacheNamespace string
+
+	// Report paths that are hardlinks of the same inode as groups with Group.Hardlinked set.
+	//
+	// Hardlinks are never reported as duplicates of each other regardless of this option,
+	// since only the first path found for an inode is considered during the search.
+	ReportHardlinks bool
+
+	// Report symlinks to files inside the search as groups with Group.Symlinked set,
+	// requires Filters.FollowSymlinks.
+	//
+	// Such symlinks are never reported as duplicates of their target regardless of this option.
+	ReportSymlinks bool
+
+	// Number of workers generating keys per device, within the overall limit of Workers.
+	// Defaults to Workers, so that a single device can use all of them.
+	DeviceWorkers int
+
+	// Number of workers generating keys per rotational disk (HDD) instead of DeviceWorkers, defaults
+	// to DefaultRotationalReaders so that concurrent reads don't make the disk seek back and forth.
+	//
+	// Rotational disks are detected through /sys/block/*/queue/rotational, so this only
+	// applies on Linux.
+	RotationalReaders int
+
+	// Approximate limit in bytes of the memory used to index the files found by the search, 0 for no limit.
+	//
+	// Each index (files by size and partial hash when staged, files by key) is kept in memory
+	// until it grows past the limit, at which point it's sorted and spilled to a temporary file
+	// in SpillDir. Spilled files are merged once all files are indexed, so groups are only
+	// streamed after every key has been generated.
+	MemoryLimit int64
+
+	// Directory of the temporary files of MemoryLimit, defaults to os.TempDir().
+	SpillDir string
+
+	// Hook that is called with the progress of the search every ProgressInterval, and
+	// a last time with Progress.Done set once the search is complete.
+	//
+	// Called from its own goroutine, so it should return quickly to keep the snapshots in time.
+	Progress func(Progress)
+
+	// Interval between calls of the Progress hook, defaults to 500ms.
+	ProgressInterval time.Duration
 }
 
 // Beauty stringifies the Cfg struct.
 func (c *Cfg) String() string {
-	keygenFn := runtime.FuncForPC(reflect.ValueOf(c.KeyGenerator).Pointer())
-	keygenFnName := filepath.Base(keygenFn.Name())
-
 	return fmt.Sprintf(
-		"\n{\n\tPath: %s\n\tFilters: \n%s\n\tKeyGenerator: %s\n}",
+		"\n{\n\tPath: %s\n\tReferences: %s\n\tFilters: \n%s\n\tKeyGenerator: %s\n\tStaged: %t\n\tVerify: %t\n}",
 		c.Paths,
+		c.References,
 		c.Filters.String(),
-		keygenFnName,
+		funcName(c.KeyGenerator),
+		c.Staged,
+		c.Verify,
 	)
 }
 
+// Returns the name of the provided function, e.g. "dupescout.Crc32HashKeyGenerator".
+func funcName(fn any) string {
+	return filepath.Base(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+}
+
+// Matches the names the compiler gives to closures and method values, e.g.
+// "dupescout.NewHashKeyGenerator.func1", which are shared by all of their instances.
+var sharedFuncName = regexp.MustCompile(`\.func\d+(\.\d+)*$|-fm$`)
+
 // Sanitizes the provided path, supports ~ and ~username.
-func sanitizePath(path string) string {
+func sanitizePath(path string) (string, error) {
 	if strings.HasPrefix(path, "~") {
 		firstSlash := strings.Index(path, "/")
 
 		if firstSlash == 1 {
 			home, err := os.UserHomeDir()
 			if err != nil {
-				log.Fatal(err)
+				return "", err
 			}
 
 			path = strings.Replace(path, "~", home, 1)
@@ -64,37 +146,151 @@ func sanitizePath(path string) string {
 			username := path[1:firstSlash]
 			userAccount, err := user.Lookup(username)
 			if err != nil {
-				log.Fatal(err)
+				return "", err
 			}
 
 			path = strings.Replace(path, path[:firstSlash], userAccount.HomeDir, 1)
 		}
 	}
 
-	path, err := filepath.Abs(path)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return path
+	return filepath.Abs(path)
 }
 
+// Returned when the paths to search in overlap in a way that can't be merged, see Cfg.Paths.
+var ErrOverlappingPaths = errors.New("overlapping paths")
+
+// Returned when a Cache or Snapshot is used with a closure KeyGenerator without a Cfg.CacheNamespace.
+var ErrCacheNamespace = errors.New("cache namespace required for closure key generators")
+
 // Sets default values for the cfg struct as needed.
-func (c *Cfg) defaults() {
-	for i, path := range c.Paths {
-		if path == "" {
-			c.Paths[i] = "." // Default to current directory
-			continue
-		}
+//
+// Paths that can't be sanitized are removed and returned as ScanErrors, while paths that
+// overlap in a way that can't be merged fail with ErrOverlappingPaths, and closure KeyGenerators
+// without a CacheNamespace fail with ErrCacheNamespace.
+func (c *Cfg) defaults() ([]*ScanError, error) {
+	var errs, refErrs []*ScanError
+	c.Paths, errs = sanitizePaths(c.Paths)
+	c.References, refErrs = sanitizePaths(c.References)
+	errs = append(errs, refErrs...)
+
+	if err := c.mergePaths(); err != nil {
+		return errs, err
+	}
+
+	if err := c.Filters.validate(); err != nil {
+		return errs, err
+	}
 
-		c.Paths[i] = sanitizePath(path)
+	if c.KeyGenerator == nil && c.Staged {
+		c.KeyGenerator = FullSha256HashKeyGenerator // Only size and partial hash collisions reach this stage
 	}
 
 	if c.KeyGenerator == nil {
 		c.KeyGenerator = Crc32HashKeyGenerator // Default to CRC32 (fast and sufficient for most cases)
 	}
 
-	if c.Workers == 0 {
-		c.Workers = runtime.GOMAXPROCS(0) / 2
+	if (c.Cache != nil || c.Snapshot != nil) && c.CacheNamespace == "" {
+		c.CacheNamespace = funcName(c.KeyGenerator)
+		if sharedFuncName.MatchString(c.CacheNamespace) {
+			return errs, fmt.Errorf("%w: %s", ErrCacheNamespace, c.CacheNamespace)
+		}
 	}
+
+	if c.ProgressInterval <= 0 {
+		c.ProgressInterval = defaultProgressInterval
+	}
+
+	if c.Workers <= 0 {
+		c.Workers = max(runtime.GOMAXPROCS(0)/2, 1)
+	}
+
+	if c.DeviceWorkers <= 0 || c.DeviceWorkers > c.Workers {
+		c.DeviceWorkers = c.Workers
+	}
+
+	if c.RotationalReaders <= 0 {
+		c.RotationalReaders = DefaultRotationalReaders
+	}
+
+	if c.Walkers <= 0 {
+		c.Walkers = DefaultWalkers
+	}
+
+	return errs, nil
+}
+
+// Resolves the symlinks of Paths and References, and drops the paths that are the same as
+// or nested in another path of the same list, so that no file is searched twice.
+//
+// Paths can't be merged across both lists, since their files can't be both references and
+// candidates, nor when nested with CrossRoots, since their files would share a root.
+func (c *Cfg) mergePaths() error {
+	c.Paths = resolvePaths(c.Paths)
+	c.References = resolvePaths(c.References)
+
+	for _, ref := range c.References {
+		for _, path := range c.Paths {
+			if insideRoots(ref, []string{path}) || insideRoots(path, []string{ref}) {
+				return fmt.Errorf("%w: reference %s overlaps with %s", ErrOverlappingPaths, ref, path)
+			}
+		}
+	}
+
+	var err error
+	if c.Paths, err = mergeNested(c.Paths, c.CrossRoots); err != nil {
+		return err
+	}
+	c.References, err = mergeNested(c.References, c.CrossRoots)
+	return err
+}
+
+// Drops the provided paths that are the same as or nested in another one, keeping the
+// order of the rest. Nested paths fail with ErrOverlappingPaths if they can't be dropped.
+func mergeNested(paths Paths, keepNested bool) (Paths, error) {
+	merged := make(Paths, 0, len(paths))
+
+	for i, path := range paths {
+		drop := false
+		for j, other := range paths {
+			if path == other {
+				drop = drop || j < i // Only the first one is kept.
+				continue
+			}
+
+			if insideRoots(path, []string{other}) {
+				if keepNested {
+					return nil, fmt.Errorf("%w: %s is nested in %s", ErrOverlappingPaths, path, other)
+				}
+				drop = true
+			}
+		}
+
+		if !drop {
+			merged = append(merged, path)
+		}
+	}
+
+	return merged, nil
+}
+
+// Sanitizes the provided paths, paths that can't be sanitized are returned as errors instead.
+func sanitizePaths(paths Paths) (Paths, []*ScanError) {
+	var errs []*ScanError
+	sanitized := make(Paths, 0, len(paths))
+
+	for _, path := range paths {
+		if path == "" {
+			path = "." // Default to current directory
+		}
+
+		s, err := sanitizePath(path)
+		if err != nil {
+			errs = append(errs, &ScanError{Path: path, Op: OpPath, Err: err})
+			continue
+		}
+
+		sanitized = append(sanitized, s)
+	}
+
+	return sanitized, errs
 }
@@ -1,7 +1,9 @@
 package dupescout
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
@@ -9,7 +11,10 @@ import (
 
 func TestSanitizePath(t *testing.T) {
 	cfg := &Cfg{Paths: []string{"~/Dev", "~/Dev/../dupescout"}}
-	path := sanitizePath(cfg.Paths[0])
+	path, err := sanitizePath(cfg.Paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	home, _ := os.UserHomeDir()
 	isWindows := os.PathSeparator == '\\'
@@ -22,7 +27,10 @@ func TestSanitizePath(t *testing.T) {
 		t.Errorf("Expected %s, got %s", home+"/Dev", path)
 	}
 
-	path = sanitizePath(cfg.Paths[1]) // Use second path now
+	path, err = sanitizePath(cfg.Paths[1]) // Use second path now
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if isWindows && path != home+"\\dupescout" {
 		t.Errorf("Expected %s, got %s", home+"\\dupescout", path)
@@ -33,6 +41,106 @@ func TestSanitizePath(t *testing.T) {
 	}
 }
 
+func TestSanitizePathUnknownUser(t *testing.T) {
+	_, err := sanitizePath("~dupescoutunknownuser/Dev")
+	if err == nil {
+		t.Error("Expected error for unknown user")
+	}
+}
+
+func TestDefaultsInvalidPaths(t *testing.T) {
+	cfg := &Cfg{Paths: []string{"~dupescoutunknownuser/Dev", "/tmp"}}
+	errs, _ := cfg.defaults()
+
+	if len(errs) != 1 || errs[0].Path != "~dupescoutunknownuser/Dev" || errs[0].Op != OpPath {
+		t.Errorf("Expected one path error for the unknown user, got %v", errs)
+	}
+
+	if len(cfg.Paths) != 1 || cfg.Paths[0] != "/tmp" {
+		t.Errorf("Expected only valid paths to remain, got %v", cfg.Paths)
+	}
+}
+
+func TestDefaultsOverlappingReferences(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a/x.txt": "Hello, World!",
+		"b/y.txt": "Hello, World!",
+	})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(a, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		paths, references []string
+		err               bool
+	}{
+		{[]string{a}, []string{b}, false},
+		{[]string{a}, []string{a}, true},
+		{[]string{dir}, []string{b}, true},
+		{[]string{b}, []string{dir}, true},
+		{[]string{a}, []string{link}, true},
+	}
+
+	for _, tc := range tcs {
+		cfg := Cfg{Paths: tc.paths, References: tc.references}
+		_, err := cfg.defaults()
+		if overlaps := errors.Is(err, ErrOverlappingPaths); overlaps != tc.err {
+			t.Errorf("Expected overlap %t for %v and references %v, got %v", tc.err, tc.paths, tc.references, err)
+		}
+	}
+}
+
+func TestDefaultsOverlappingPaths(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a/x.txt": "Hello, World!",
+		"b/y.txt": "Hello, World!",
+	})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(a, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		cfg      Cfg
+		expected Paths
+		err      bool
+	}{
+		{Cfg{Paths: []string{a, b, link}}, Paths{a, b}, false},
+		{Cfg{Paths: []string{a, dir, b, dir}}, Paths{dir}, false},
+		{Cfg{Paths: []string{link, a}, CrossRoots: true}, Paths{a}, false},
+		{Cfg{Paths: []string{dir, a}, CrossRoots: true}, nil, true},
+		{Cfg{Paths: []string{dir}, References: []string{link}}, nil, true},
+		{Cfg{Paths: []string{"", dir}}, Paths{dir}, false},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, tc := range tcs {
+		cfg := tc.cfg
+		_, err := cfg.defaults()
+		if tc.err {
+			if !errors.Is(err, ErrOverlappingPaths) {
+				t.Errorf("Expected ErrOverlappingPaths for %v, got %v", tc.cfg.Paths, err)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(cfg.Paths, tc.expected) {
+			t.Errorf("Expected %v for %v, got %v (%v)", tc.expected, tc.cfg.Paths, cfg.Paths, err)
+		}
+	}
+}
+
 func TestDefaults(t *testing.T) {
 	cfg := &Cfg{}
 	cfg.defaults()
@@ -41,16 +149,35 @@ func TestDefaults(t *testing.T) {
 		t.Error("Expected key generator to be set to default: Crc32HashKeyGenerator")
 	}
 
-	defaultWorkers := runtime.GOMAXPROCS(0) / 2
+	defaultWorkers := max(runtime.GOMAXPROCS(0)/2, 1)
 	if cfg.Workers != defaultWorkers {
 		t.Errorf("Expected workers to be set to default: %d", defaultWorkers)
 	}
 
-	cfg = &Cfg{Workers: 5}
+	if cfg.Walkers != DefaultWalkers {
+		t.Errorf("Expected walkers to be set to default: %d", DefaultWalkers)
+	}
+
+	cfg = &Cfg{Workers: 5, Walkers: 2, Paths: []string{"/tmp", "/var", "/srv"}}
+	cfg.defaults()
+
+	if cfg.Workers != 5 || cfg.Walkers != 2 {
+		t.Errorf("Expected workers to be 5 and walkers to be 2")
+	}
+
+	if cfg.DeviceWorkers != 5 {
+		t.Errorf("Expected device workers to default to workers, got %d", cfg.DeviceWorkers)
+	}
+
+	if cfg.CacheNamespace != "" {
+		t.Errorf("Expected cache namespace to be empty without a cache")
+	}
+
+	cfg = &Cfg{KeyGenerator: FullCrc32HashKeyGenerator, Cache: &Cache{}}
 	cfg.defaults()
 
-	if cfg.Workers != 5 {
-		t.Errorf("Expected workers to be 5")
+	if cfg.CacheNamespace != "dupescout.FullCrc32HashKeyGenerator" {
+		t.Errorf("Expected cache namespace to be dupescout.FullCrc32HashKeyGenerator, got %s", cfg.CacheNamespace)
 	}
 
 	cfg.KeyGenerator = Sha256HashKeyGenerator
@@ -59,3 +186,40 @@ func TestDefaults(t *testing.T) {
 		t.Errorf("Expected key generator to be set to Sha256HashKeyGenerator")
 	}
 }
+
+func TestDefaultsCacheNamespace(t *testing.T) {
+	sha512 := NewHashKeyGenerator(HashFuncs["sha512"], HashOptions{})
+
+	cfg := &Cfg{KeyGenerator: sha512, Cache: &Cache{}}
+	if _, err := cfg.defaults(); !errors.Is(err, ErrCacheNamespace) {
+		t.Errorf("Expected ErrCacheNamespace for a closure key generator, got %v", err)
+	}
+
+	cfg = &Cfg{KeyGenerator: NewSampledKeyGenerator(SampleOptions{}), Snapshot: &Snapshot{}}
+	if _, err := cfg.defaults(); !errors.Is(err, ErrCacheNamespace) {
+		t.Errorf("Expected ErrCacheNamespace for a closure key generator, got %v", err)
+	}
+
+	cfg = &Cfg{KeyGenerator: sha512, Cache: &Cache{}, CacheNamespace: "sha512"}
+	if _, err := cfg.defaults(); err != nil || cfg.CacheNamespace != "sha512" {
+		t.Errorf("Expected cache namespace sha512, got %s (%v)", cfg.CacheNamespace, err)
+	}
+
+	cfg = &Cfg{KeyGenerator: sha512}
+	if _, err := cfg.defaults(); err != nil {
+		t.Errorf("Expected no error without a cache, got %v", err)
+	}
+}
+
+func TestDefaultsWorkersNeverZero(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	for _, workers := range []int{0, -1} {
+		cfg := &Cfg{Workers: workers, Walkers: workers}
+		cfg.defaults()
+
+		if cfg.Workers != 1 || cfg.Walkers != DefaultWalkers {
+			t.Errorf("Expected 1 worker and %d walkers on a single CPU for %d, got %d and %d", DefaultWalkers, workers, cfg.Workers, cfg.Walkers)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package dupescout
+
+import (
+	"errors"
+	"sync"
+)
+
+// Default number of files read concurrently from the same rotational disk.
+const DefaultRotationalReaders = 1
+
+// Pools of workers per device, so that each device is read with its own concurrency limit
+// and a slow disk never holds up the files of the others.
+//
+// The workers of all devices share an overall limit, so adding devices never adds more
+// concurrent readers than the limit allows.
+type devicePools struct {
+	mu         sync.Mutex
+	pools      map[uint64]*pool[File]
+	slots      chan struct{} // held by the workers of all devices while running fn
+	workers    int           // workers per device, unless it's a rotational disk
+	rotational int           // workers per rotational disk
+	fn         func(File) error
+}
+
+func newDevicePools(limit, workers, rotational int, fn func(File) error) *devicePools {
+	return &devicePools{
+		pools:      map[uint64]*pool[File]{},
+		slots:      make(chan struct{}, max(limit, 1)),
+		workers:    workers,
+		rotational: rotational,
+		fn:         fn,
+	}
+}
+
+// Queues the provided file in the pool of its device, which is started on its first file.
+func (d *devicePools) submit(f File) {
+	d.mu.Lock()
+	p, ok := d.pools[f.Dev]
+	if !ok {
+		workers := d.workers
+		if isRotational(f.Dev) {
+			workers = d.rotational
+		}
+		p = startPool(workers, d.run)
+		d.pools[f.Dev] = p
+	}
+	d.mu.Unlock()
+
+	p.submit(f)
+}
+
+// Runs fn for the provided file once one of the slots shared by all devices is free.
+func (d *devicePools) run(f File) error {
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+	return d.fn(f)
+}
+
+// Waits until the files of all devices are done and returns the first error of each.
+//
+// No more files can be submitted afterwards.
+func (d *devicePools) wait() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs []error
+	for _, p := range d.pools {
+		errs = append(errs, p.wait())
+	}
+	return errors.Join(errs...)
+}
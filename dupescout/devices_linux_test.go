@@ -0,0 +1,89 @@
+package dupescout
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDevicePoolsLimits(t *testing.T) {
+	fakeSysDevBlock(t, map[string]bool{"8:0": true, "259:0": false})
+	hdd, ssd := uint64(8<<8|1), uint64(259<<8|1)
+
+	var mu sync.Mutex
+	active := map[uint64]int{}
+	peak := map[uint64]int{}
+	var done atomic.Int32
+
+	pools := newDevicePools(4, 4, 1, func(f File) error {
+		mu.Lock()
+		active[f.Dev]++
+		peak[f.Dev] = max(peak[f.Dev], active[f.Dev])
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active[f.Dev]--
+		mu.Unlock()
+		done.Add(1)
+		return nil
+	})
+
+	// Interleaved, so a busy disk must not hold up the files of the other device.
+	for i := 0; i < 16; i++ {
+		pools.submit(File{Dev: hdd})
+		pools.submit(File{Dev: ssd})
+	}
+
+	if err := pools.wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if done.Load() != 32 {
+		t.Errorf("Expected 32 files to be done, got %d", done.Load())
+	}
+
+	if peak[hdd] != 1 {
+		t.Errorf("Expected at most 1 concurrent reader on the rotational disk, got %d", peak[hdd])
+	}
+
+	if peak[ssd] < 2 || peak[ssd] > 4 {
+		t.Errorf("Expected 2 to 4 concurrent readers on the ssd, got %d", peak[ssd])
+	}
+}
+
+func TestDevicePoolsOverallLimit(t *testing.T) {
+	fakeSysDevBlock(t, map[string]bool{})
+
+	var mu sync.Mutex
+	active, peak := 0, 0
+
+	pools := newDevicePools(3, 2, 1, func(f File) error {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	})
+
+	// Many devices, which would allow 20 concurrent readers without the overall limit.
+	for i := 0; i < 40; i++ {
+		pools.submit(File{Dev: uint64(259<<8 | i%10)})
+	}
+
+	if err := pools.wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if peak < 2 || peak > 3 {
+		t.Errorf("Expected 2 to 3 concurrent readers across all devices, got %d", peak)
+	}
+}
@@ -1,187 +1,534 @@
 package dupescout
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/signal"
-	"path/filepath"
-	"syscall"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/puzpuzpuz/xsync/v2"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type pair struct {
-	key  string // depends on the KeyGeneratorFunc
-	path string
+	key     string // depends on the KeyGeneratorFunc
+	file    File
+	variant int // files of the same key and variant have the same contents, see verifier
 }
 
 type dupescout struct {
-	g           *errgroup.Group  // "wait group" to limit the num of concurrent search workers
-	pairs       chan *pair       // channel to send pairs to, which are processed and sent to the caller
-	shutdown    chan os.Signal   // channel to receive shutdown signals on
-	generatorFn KeyGeneratorFunc // function that generates a key for a given path to identify duplicates
-	filters     Filters          // filters to apply when searching for duplicates
+	walker         *walker                        // workers reading the directories of the search
+	hashers        *devicePools                   // workers generating the keys of the files found by the walker
+	workers        int                            // number of workers across all devices of each hashing stage
+	deviceWorkers  int                            // number of workers per device of each hashing stage
+	rotational     int                            // number of workers per rotational disk of each hashing stage
+	pairs          chan *pair                     // channel to send pairs to, which are processed and sent to the caller
+	ctx            context.Context                // context to stop the search when it's done
+	cancel         context.CancelCauseFunc        // stops the search with the provided error, e.g. when an index fails
+	generatorFn    func(File) (string, error)     // generates the key of a file to identify duplicates, counting the bytes read
+	partialFn      func(File) (string, error)     // generates the partial hash of a file when staged, counting the bytes read
+	filters        Filters                        // filters to apply when searching for duplicates
+	staged         bool                           // whether files are grouped by size and partial hash before key generation
+	verify         bool                           // whether files with the same key are compared byte by byte
+	verifier       *verifier                      // variants of the files of each key, nil unless verifying without a memory limit
+	sizes          fileIndex                      // files grouped by size, only used when staged
+	keys           fileIndex                      // files grouped by key, nil unless there is a memory limit
+	groups         *xsync.MapOf[string, []*group] // key -> groups of files with that key, unless there is a memory limit
+	nextID         int                            // id of the next group, only used by the pair consumer
+	memoryLimit    int64                          // approximate memory limit of each index, 0 for no limit
+	spillDir       string                         // directory of the temporary files of indexes past the memory limit
+	cache          *Cache                         // cache to reuse the keys of unchanged files, nil if disabled
+	cacheNs        string                         // namespace of the keys generated by generatorFn in the cache
+	snapshot       *Snapshot                      // snapshot of the previous search to reuse keys from, nil if disabled
+	links          *hardlinks                     // files with multiple hardlinks, to skip the paths of already found inodes
+	reportLinks    bool                           // whether hardlinks of the same inode are reported as groups
+	symlinks       *symlinks                      // visited dirs and symlinked files, only used when following symlinks
+	reportSymlinks bool                           // whether symlinks to files inside the search are reported as groups
+	roots          []string                       // resolved paths to search in, to check whether symlink targets are part of the search
+	references     bool                           // whether groups are only reported once they hold both references and candidates
+	crossRoots     bool                           // whether groups are only reported once they hold files of different roots
+	fsTypes        *xsync.MapOf[uint64, string]   // device -> filesystem type, only used with filesystem type filters
+	errs           *scanErrors                    // errors of paths that were skipped without stopping the search
+	progress       *progress                      // counters of the progress of the search
+	watcher        *watcher                       // watches the walked directories for changes, nil unless watching
 }
 
-func newDupeScout(c Cfg) *dupescout {
-	g := new(errgroup.Group)
-	g.SetLimit(c.Workers)
-
+func newDupeScout(ctx context.Context, c Cfg) *dupescout {
+	ctx, cancel := context.WithCancelCause(ctx)
+	progress := newProgress()
 	return &dupescout{
-		g:           g,
-		pairs:       make(chan *pair, c.Workers),
-		shutdown:    make(chan os.Signal, 1),
-		generatorFn: c.KeyGenerator,
-		filters:     c.Filters,
+		workers:        c.Workers,
+		deviceWorkers:  c.DeviceWorkers,
+		rotational:     c.RotationalReaders,
+		pairs:          make(chan *pair, c.Workers),
+		ctx:            ctx,
+		cancel:         cancel,
+		generatorFn:    progress.counting(c.KeyGenerator),
+		partialFn:      progress.counting(Crc32HashKeyGenerator),
+		filters:        c.Filters,
+		staged:         c.Staged,
+		verify:         c.Verify,
+		sizes:          newFileIndex(c.MemoryLimit, c.SpillDir),
+		groups:         xsync.NewMapOf[[]*group](),
+		memoryLimit:    c.MemoryLimit,
+		spillDir:       c.SpillDir,
+		cache:          c.Cache,
+		cacheNs:        c.CacheNamespace,
+		snapshot:       c.Snapshot,
+		links:          newHardlinks(),
+		reportLinks:    c.ReportHardlinks,
+		symlinks:       newSymlinks(),
+		reportSymlinks: c.ReportSymlinks,
+		roots:          append(slices.Clone(c.Paths), c.References...),
+		references:     len(c.References) > 0,
+		crossRoots:     c.CrossRoots,
+		fsTypes:        newFsTypes(),
+		errs:           &scanErrors{},
+		progress:       progress,
 	}
 }
 
 // Starts the search for duplicates which can be customized by the provided Cfg struct.
-func run(c Cfg, dupesChan chan []string, stream bool) error {
-	c.defaults()
-	dup := newDupeScout(c)
+//
+// Cancelling the provided context stops the search once the current workers are done.
+func run(ctx context.Context, c Cfg, updates chan GroupUpdate) error {
+	pathErrs, err := c.defaults()
+	if err == nil {
+		err = c.Snapshot.begin(c.CacheNamespace, c.Staged)
+	}
+	if err != nil {
+		close(updates)
+		return err
+	}
 
-	go dup.consumePairs(dupesChan, stream)
-	go gracefulShutdown(dup.shutdown)
+	dup := newDupeScout(ctx, c)
+	defer dup.cancel(nil)
+	dup.errs.errs = append(dup.errs.errs, pathErrs...)
+
+	err = dup.search(c, updates)
+	return errors.Join(err, dup.errs.err())
+}
+
+// Searches the paths of the provided Cfg and streams the groups to the provided channel,
+// which is closed once the search is complete.
+//
+// Returns the error that stopped the search, if any. ScanErrors are left in dup.errs.
+func (dup *dupescout) search(c Cfg, updates chan GroupUpdate) error {
+	ctx := dup.ctx
+	start := time.Now()
+
+	if c.MemoryLimit > 0 {
+		dup.keys = dup.newIndex()
+	} else if c.Verify {
+		dup.verifier = newVerifier(dup.progress, dup.errs)
+	}
+
+	var consumeErr error
+	consumed := make(chan struct{})
+	go func() {
+		consumeErr = dup.consumePairs(updates)
+		close(consumed)
+	}()
+
+	if c.Progress != nil {
+		reported := make(chan struct{})
+		defer func() { <-reported }()
+
+		go func() {
+			dup.progress.report(c.Progress, c.ProgressInterval, consumed)
+			close(reported)
+		}()
+	}
+
+	// Walkers and hashers are sized separately and only connected through the queue of
+	// the hashers, so neither can starve the other.
+	dup.hashers = newDevicePools(c.Workers, c.DeviceWorkers, c.RotationalReaders, dup.producePair)
+	dup.walker = dup.startWalker(c.Walkers)
 
 	for _, path := range c.Paths {
-		p := path
-		dup.g.Go(func() error {
-			return dup.search(p)
-		})
+		dup.walker.walkRoot(path, false)
+	}
+	for _, path := range c.References {
+		dup.walker.walkRoot(path, true)
+	}
+
+	err := dup.walker.wait()
+	if !dup.staged {
+		dup.progress.enter(StageHash)
+	}
+
+	if err == nil && dup.staged {
+		err = dup.runStages()
 	}
 
-	err := dup.g.Wait()
+	err = errors.Join(err, dup.hashers.wait())
+
 	close(dup.pairs) // Trigger pair consumer to process the results.
-	return err
+	<-consumed
+
+	// An incomplete search would drop the files it didn't get to from the snapshot.
+	if err == nil && consumeErr == nil && ctx.Err() == nil {
+		dup.snapshot.commit(start)
+	}
+
+	// The cause is the error that stopped the search, if it wasn't cancelled by the caller.
+	return errors.Join(err, consumeErr, context.Cause(ctx))
 }
 
-// Runs the duplicate search and returns a slice of all duplicate paths.
-func GetResults(c Cfg) ([]string, error) {
-	dupesChan := make(chan []string, 1)
-	err := run(c, dupesChan, false)
-	return <-dupesChan, err
+// Runs the duplicate search and returns a slice of all duplicate files, leaving out the
+// files of Cfg.References which are meant to be kept.
+//
+// Paths that can't be accessed or vanish during the search are skipped and reported
+// through a *ScanErrors error along with the results.
+func GetResults(c Cfg) ([]File, error) {
+	return GetResultsContext(context.Background(), c)
 }
 
-// Runs the duplicate search and streams the duplicate paths to the provided channel
-// as they are found.
-func StreamResults(c Cfg, dupesChan chan []string) error {
-	return run(c, dupesChan, true)
+// Like GetResults, but stops the search when the provided context is cancelled.
+//
+// The duplicates found until then are returned along with the context error.
+func GetResultsContext(ctx context.Context, c Cfg) ([]File, error) {
+	groups, err := GetGroupsContext(ctx, c)
+
+	var dupes []File
+	for _, g := range groups {
+		if g.Deduplicated() {
+			continue
+		}
+		dupes = append(dupes, candidates(g.Files)...)
+	}
+
+	return dupes, err
 }
 
-// Processes the produced pairs and sends the results to the provided channel.
-// Depending on the stream bool, results are either sent in chunks or all at once.
-func (dup *dupescout) consumePairs(dupesChan chan []string, stream bool) {
+// Runs the duplicate search and streams the duplicate files to the provided channel
+// as they are found, leaving out the files of Cfg.References like GetResults.
+func StreamResults(c Cfg, dupesChan chan []File) error {
+	return StreamResultsContext(context.Background(), c, dupesChan)
+}
+
+// Like StreamResults, but stops the search when the provided context is cancelled.
+func StreamResultsContext(ctx context.Context, c Cfg, dupesChan chan []File) error {
 	defer close(dupesChan)
 
-	// key -> last encountered path
-	m := xsync.NewMapOf[string]()
+	updates := make(chan GroupUpdate, cap(dupesChan))
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamGroupsContext(ctx, c, updates)
+	}()
 
-	for p := range dup.pairs {
-		storedPath, ok := m.Load(p.key)
-		if !ok {
-			m.Store(p.key, p.path)
+	for u := range updates {
+		if u.Deduplicated() {
 			continue
 		}
-		// When storedPath is not empty, it indicates that we have found the first duplicate,
-		// so we send both the stored path and the current path.
-		if storedPath != "" {
-			m.Store(p.key, "")
-			paths := []string{storedPath, p.path}
-			if stream {
-				// Send in chunks.
-				dupesChan <- paths
-				continue
-			}
-			// Not streaming, collect all duplicate paths.
-			select {
-			case currDupes := <-dupesChan:
-				dupesChan <- append(currDupes, paths...)
-			default:
-				dupesChan <- paths
+		if files := candidates(u.Files); len(files) > 0 {
+			dupesChan <- files
+		}
+	}
+
+	return <-errChan
+}
+
+// Runs the duplicate search and returns all groups of duplicates.
+func GetGroups(c Cfg) ([]Group, error) {
+	return GetGroupsContext(context.Background(), c)
+}
+
+// Like GetGroups, but stops the search when the provided context is cancelled.
+//
+// The groups found until then are returned along with the context error.
+func GetGroupsContext(ctx context.Context, c Cfg) ([]Group, error) {
+	updates := make(chan GroupUpdate, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamGroupsContext(ctx, c, updates)
+	}()
+
+	var groups []Group
+	for u := range updates {
+		groups = u.apply(groups)
+	}
+
+	return groups, <-errChan
+}
+
+// Runs the duplicate search and streams updates to the provided channel whenever a
+// group of duplicates is created or a file is added to an existing group.
+//
+// The channel is closed once the search is complete.
+func StreamGroups(c Cfg, updates chan GroupUpdate) error {
+	return StreamGroupsContext(context.Background(), c, updates)
+}
+
+// Like StreamGroups, but stops the search when the provided context is cancelled.
+func StreamGroupsContext(ctx context.Context, c Cfg, updates chan GroupUpdate) error {
+	return run(ctx, c, updates)
+}
+
+// Files that share the same key and, when verifying, the same contents.
+//
+// Only becomes a Group once a second file is added, see dupescout.complete.
+type group struct {
+	id      int
+	created bool // whether the group was reported, which assigns its id
+	variant int  // variant of the key whose files are identical, see verifier
+	files   []File
+}
+
+// Reports whether the provided group is to be reported, which requires a second file, and
+// files of different roots with Cfg.CrossRoots or both references and candidates with
+// Cfg.References.
+func (dup *dupescout) complete(g *group) bool {
+	if len(g.files) < 2 {
+		return false
+	}
+
+	refs := 0
+	crossRoots := false
+	for _, f := range g.files {
+		if f.Reference {
+			refs++
+		}
+		if f.Root != g.files[0].Root {
+			crossRoots = true
+		}
+	}
+
+	if dup.references && (refs == 0 || refs == len(g.files)) {
+		return false
+	}
+	return !dup.crossRoots || crossRoots
+}
+
+// Helper to get the provided files without the ones of Cfg.References.
+func candidates(files []File) []File {
+	var c []File
+	for _, f := range files {
+		if !f.Reference {
+			c = append(c, f)
+		}
+	}
+	return c
+}
+
+// Processes the produced pairs and sends group updates to the provided channel.
+//
+// With a memory limit, the pairs are indexed on disk and only grouped once all of them
+// are produced, otherwise groups are updated as soon as a pair arrives.
+func (dup *dupescout) consumePairs(updates chan GroupUpdate) error {
+	defer close(updates)
+
+	var err error
+	if dup.keys == nil {
+		for p := range dup.pairs {
+			groups, _ := dup.groups.Load(p.key)
+			groups, _ = dup.consume(groups, p, updates)
+			dup.groups.Store(p.key, groups)
+		}
+	} else {
+		for p := range dup.pairs {
+			dup.index(dup.keys, p.key, p.file)
+		}
+
+		err = errors.Join(dup.groupCollisions(updates), dup.keys.close())
+	}
+
+	// The search is done at this point, so all hardlinks have been found.
+	if dup.reportLinks {
+		groups := dup.links.groups()
+		keys := maps.Keys(groups)
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			updates <- GroupUpdate{Kind: HardlinksFound, Group: dup.nextID, Key: key, Files: groups[key]}
+			dup.nextID++
+		}
+	}
+
+	if dup.reportSymlinks {
+		groups := dup.symlinks.groups()
+		targets := maps.Keys(groups)
+		slices.Sort(targets)
+
+		for _, target := range targets {
+			updates <- GroupUpdate{Kind: SymlinksFound, Group: dup.nextID, Key: target, Files: groups[target]}
+			dup.nextID++
+		}
+	}
+
+	return err
+}
+
+// Groups the files of each key of the index that holds more than one file once all pairs
+// are indexed, see Cfg.MemoryLimit.
+//
+// When verifying, the files of different keys are compared concurrently by a pool of
+// workers, while the groups are still consumed one key at a time.
+func (dup *dupescout) groupCollisions(updates chan GroupUpdate) error {
+	var mu sync.Mutex // guards the consumption, which assigns the ids of the groups
+	consumeKey := func(key string, files []File) error {
+		pairs := make([]*pair, 0, len(files))
+		v := newVerifier(dup.progress, dup.errs)
+		for _, f := range files {
+			p := &pair{key: key, file: f}
+			if dup.verify {
+				variant, err := v.assign(key, f)
+				if err != nil {
+					// Can't tell whether the file is a duplicate, so it's left out of the results.
+					dup.errs.add(f.Path, OpVerify, err)
+					continue
+				}
+				p.variant = variant
 			}
-			continue
+			pairs = append(pairs, p)
 		}
-		// Previous duplicate paths have already been sent, so just send the current path.
-		if stream {
-			dupesChan <- []string{p.path}
-			continue
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var groups []*group
+		for _, p := range pairs {
+			groups, _ = dup.consume(groups, p, updates)
 		}
-		// Select is not needed since at this point the dupesChan can't be empty or full.
-		dupesChan <- append(<-dupesChan, p.path)
+		return nil
+	}
+
+	if !dup.verify {
+		return dup.keys.collisions(consumeKey)
+	}
+
+	type collision struct {
+		key   string
+		files []File
+	}
+	verifiers := startPool(dup.workers, func(c collision) error {
+		return consumeKey(c.key, c.files)
+	})
+
+	err := dup.keys.collisions(func(key string, files []File) error {
+		verifiers.submit(collision{key, files})
+		return nil
+	})
+	return errors.Join(err, verifiers.wait())
+}
+
+// Adds the file of the provided pair to the group of its variant among the provided groups
+// of its key and sends the resulting update, if any.
+//
+// Returns the updated groups along with the matching group.
+func (dup *dupescout) consume(groups []*group, p *pair, updates chan GroupUpdate) ([]*group, *group) {
+	groups, g := dup.addToGroup(groups, p)
+
+	switch {
+	case g.created:
+		updates <- GroupUpdate{Kind: MemberAdded, Group: g.id, Key: p.key, Files: []File{p.file}}
+	case dup.complete(g):
+		// First duplicate found, so the group is created with all of its files.
+		g.id = dup.nextID
+		g.created = true
+		dup.nextID++
+		dup.progress.groups.Add(1)
+		n := len(g.files)
+		updates <- GroupUpdate{Kind: GroupCreated, Group: g.id, Key: p.key, Files: g.files[:n:n], New: dup.snapshot.newGroup(p.key)}
+	default:
+		// No duplicates yet.
+	}
+
+	return groups, g
+}
+
+// Adds the file of the provided pair to the group of its variant among the provided groups
+// of its key, and returns the updated groups along with the matching group.
+//
+// The variants are already told apart by the verifier, so files are never read here.
+func (dup *dupescout) addToGroup(groups []*group, p *pair) ([]*group, *group) {
+	for _, g := range groups {
+		if g.variant == p.variant {
+			g.files = append(g.files, p.file)
+			return groups, g
+		}
+	}
+
+	g := &group{variant: p.variant, files: []File{p.file}}
+	return append(groups, g), g
+}
+
+// Returns a new index of files by key, which spills to disk past the memory limit.
+func (dup *dupescout) newIndex() fileIndex {
+	return newFileIndex(dup.memoryLimit, dup.spillDir)
+}
+
+// Adds the provided file to the provided index, cancelling the search if indexing more
+// files would exceed the memory limit.
+func (dup *dupescout) index(idx fileIndex, key string, f File) {
+	if err := idx.add(key, f); err != nil {
+		dup.cancel(err)
 	}
 }
 
 // Produces a pair with the key which is generated by `dup.generatorFn` and the path
 // which is then sent to the pairs channel.
-func (dup *dupescout) producePair(path string) error {
+func (dup *dupescout) producePair(f File) error {
 	if dup.shuttingDown() {
 		return nil // Stop pair production if shutdown is in progress.
 	}
 
-	key, err := dup.generatorFn(path)
+	dup.progress.hashing(f)
+	defer dup.progress.hashed(f)
+
+	path := f.Path
+	key, err := dup.snapshot.key(f, func() (string, error) {
+		return dup.cache.key(dup.cacheNs, f, dup.generatorFn)
+	})
 	if err != nil {
 		if errors.Is(err, ErrSkipFile) {
 			return nil // Don't collect ErrSkipFile errors
 		}
-		return err
+		return dup.errs.recover(path, OpKey, err)
 	}
 
 	if key == "" {
 		return fmt.Errorf("\nkey generator returned an empty key for path: %s", path)
 	}
 
-	dup.pairs <- &pair{key, path}
-	return nil
-}
+	if dup.staged {
+		key = sizedKey(f.Size, key)
+	}
 
-// Walks the tree of the provided dir and triggers the production of pairs for each valid file.
-func (dup *dupescout) search(dir string) error {
-	return filepath.WalkDir(dir, func(path string, de os.DirEntry, err error) error {
-		if dup.shuttingDown() {
+	f.Key = key
+	p := &pair{key: key, file: f}
+	if dup.verifier != nil {
+		if p.variant, err = dup.verifier.assign(key, f); err != nil {
+			// Can't tell whether the file is a duplicate, so it's left out of the results.
+			dup.errs.add(path, OpVerify, err)
 			return nil
 		}
+	}
 
-		if err != nil {
-			return err
-		}
-
-		if de.IsDir() && dup.filters.skipDir(path) {
-			return filepath.SkipDir
-		}
+	dup.pairs <- p
+	return nil
+}
 
-		if de.Type().IsRegular() && !dup.filters.skipFile(path) {
-			fi, err := de.Info()
-			if err != nil || fi.Size() == 0 {
-				return nil
-			}
+// Triggers the production of a pair for the provided file, or defers it to the
+// stages when staged.
+func (dup *dupescout) addFile(f File) {
+	dup.progress.found(f)
+	dup.snapshot.found(f)
 
-			dup.g.Go(func() error {
-				return dup.producePair(path)
-			})
-		}
+	if dup.staged {
+		// Key generation is deferred until all files are grouped by size.
+		dup.index(dup.sizes, strconv.FormatInt(f.Size, 10), f)
+		return
+	}
 
-		return nil
-	})
+	dup.progress.queued(f)
+	dup.hashers.submit(f)
 }
 
-// Helper to check if a shutdown signal has been received.
+// Helper to check if the search has been stopped through its context.
 func (dup *dupescout) shuttingDown() bool {
-	select {
-	case <-dup.shutdown:
-		return true
-	default:
-		return false
-	}
-}
-
-// Sets up a signal handler worker for graceful shutdown.
-func gracefulShutdown(shutdown chan os.Signal) {
-	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
-	<-shutdown
-	log.Println("\nReceived signal, shutting down after current workers are done...")
-	close(shutdown)
+	return dup.ctx.Err() != nil
 }
@@ -0,0 +1,677 @@
+package dupescout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Helper to create a tree of files with the given contents inside a temp dir.
+func createTempTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// Helper to get the base names of the provided files in sorted order.
+func baseNames(files []File) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f.Path)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGetResults(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt":     "Hello, World!",
+		"sub/b.txt": "Hello, World!",
+		"c.txt":     "Go rocks!",
+	})
+
+	dupes, err := GetResults(Cfg{Paths: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := baseNames(dupes); len(names) != 2 || names[0] != "a.txt" || names[1] != "b.txt" {
+		t.Errorf("Expected [a.txt b.txt], got %v", names)
+	}
+
+	for _, f := range dupes {
+		fi, err := os.Stat(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.Size != fi.Size() || !f.ModTime.Equal(fi.ModTime()) || f.Mode != fi.Mode() {
+			t.Errorf("Expected %s to match its file info, got %+v", f.Path, f)
+		}
+
+		if f.Key != dupes[0].Key || f.Key == "" {
+			t.Errorf("Expected both files to share a key, got %q and %q", f.Key, dupes[0].Key)
+		}
+	}
+}
+
+func TestGetResultsStaged(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt":    "Hello, World!",
+		"b.txt":    "Hello, World!",
+		"c.txt":    "Hello, Gophers!", // unique size
+		"d.txt":    "Go rocks!",
+		"e.txt":    "Go rules!", // same size as d.txt, different content
+		"f/g.txt":  "Hello, World!",
+		"f/h.json": "{}",
+	})
+
+	var calls atomic.Int32
+	keygen := func(path string) (string, error) {
+		calls.Add(1)
+		return FullSha256HashKeyGenerator(path)
+	}
+
+	dupes, err := GetResults(Cfg{Paths: []string{dir}, KeyGenerator: keygen, Staged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := baseNames(dupes)
+	if len(names) != 3 || names[0] != "a.txt" || names[1] != "b.txt" || names[2] != "g.txt" {
+		t.Errorf("Expected [a.txt b.txt g.txt], got %v", names)
+	}
+
+	// Only a.txt, b.txt and g.txt share both size and partial hash.
+	if calls.Load() != 3 {
+		t.Errorf("Expected key generator to be called 3 times, got %d", calls.Load())
+	}
+}
+
+func TestGetResultsStagedSizeScoped(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "abc",
+		"b.txt": "abc",
+		"c.txt": "abcd",
+		"d.txt": "abcd",
+	})
+
+	// Every file gets the same key, so only the size keeps the groups apart.
+	keygen := func(path string) (string, error) {
+		return "same", nil
+	}
+
+	// Streamed results start every new group with a chunk of two paths.
+	groups := 0
+	dupesChan := make(chan []File)
+	go func() {
+		if err := StreamResults(Cfg{Paths: []string{dir}, KeyGenerator: keygen, Staged: true}, dupesChan); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for dupes := range dupesChan {
+		if len(dupes) == 2 {
+			groups++
+		}
+	}
+
+	if groups != 2 {
+		t.Errorf("Expected 2 groups, got %d", groups)
+	}
+}
+
+func TestGetResultsVerify(t *testing.T) {
+	header := strings.Repeat("h", 1024*16)
+	dir := createTempTree(t, map[string]string{
+		"a.mkv": header + "first",
+		"b.mkv": header + "first",
+		"c.mkv": header + "other",
+		"d.mkv": header + "other",
+		"e.mkv": header + "third",
+	})
+
+	// All files share the same first 16KB, so the default key generator groups them all together.
+	dupes, err := GetResults(Cfg{Paths: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dupes) != 5 {
+		t.Errorf("Expected 5 duplicates without verifying, got %v", baseNames(dupes))
+	}
+
+	groups := 0
+	dupesChan := make(chan []File)
+	go func() {
+		if err := StreamResults(Cfg{Paths: []string{dir}, Verify: true}, dupesChan); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dupes = nil
+	for files := range dupesChan {
+		if len(files) == 2 {
+			groups++
+		}
+		dupes = append(dupes, files...)
+	}
+
+	names := baseNames(dupes)
+	if len(names) != 4 || names[0] != "a.mkv" || names[1] != "b.mkv" || names[2] != "c.mkv" || names[3] != "d.mkv" {
+		t.Errorf("Expected [a.mkv b.mkv c.mkv d.mkv], got %v", names)
+	}
+
+	if groups != 2 {
+		t.Errorf("Expected 2 groups, got %d", groups)
+	}
+
+	// Collisions of the spilled index are verified once all files are indexed.
+	grouped, err := GetGroups(Cfg{Paths: []string{dir}, Verify: true, MemoryLimit: 1024, SpillDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(grouped) != 2 {
+		t.Errorf("Expected 2 groups with a memory limit, got %+v", grouped)
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt":     "Hello, World!",
+		"sub/b.txt": "Hello, World!",
+		"sub/c.txt": "Hello, World!",
+		"d.txt":     "Go rocks!",
+		"e.txt":     "Go rocks!",
+		"f.txt":     "JavaScript rocks!",
+	})
+
+	groups, err := GetGroups(Cfg{Paths: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return len(groups[i].Files) < len(groups[j].Files)
+	})
+
+	if names := baseNames(groups[0].Files); !reflect.DeepEqual(names, []string{"d.txt", "e.txt"}) {
+		t.Errorf("Expected [d.txt e.txt], got %v", names)
+	}
+
+	if names := baseNames(groups[1].Files); !reflect.DeepEqual(names, []string{"a.txt", "b.txt", "c.txt"}) {
+		t.Errorf("Expected [a.txt b.txt c.txt], got %v", names)
+	}
+
+	if groups[0].Reclaimable != 9 || groups[1].Reclaimable != 26 {
+		t.Errorf("Expected 9 and 26 reclaimable bytes, got %d and %d", groups[0].Reclaimable, groups[1].Reclaimable)
+	}
+
+	for _, g := range groups {
+		if g.Key == "" {
+			t.Errorf("Expected group %d to have a key", g.ID)
+		}
+	}
+}
+
+func TestGetGroupsReferences(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"library/a.txt":   "Hello, World!",
+		"library/b.txt":   "Go rocks!",
+		"library/c.txt":   "Rust rocks!",
+		"library/d.txt":   "Rust rocks!",
+		"downloads/e.txt": "Hello, World!",
+		"downloads/f.txt": "Go rocks!",
+		"downloads/g.txt": "Go rocks!",
+		"downloads/h.txt": "JavaScript rocks!",
+		"downloads/i.txt": "JavaScript rocks!",
+	})
+
+	cfg := Cfg{
+		Paths:      []string{filepath.Join(dir, "downloads")},
+		References: []string{filepath.Join(dir, "library")},
+	}
+
+	groups, err := GetGroups(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Groups with only references (c, d) or only candidates (h, i) are left out.
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return len(groups[i].Files) < len(groups[j].Files)
+	})
+
+	if names := baseNames(groups[0].Files); !reflect.DeepEqual(names, []string{"a.txt", "e.txt"}) {
+		t.Errorf("Expected [a.txt e.txt], got %v", names)
+	}
+
+	if names := baseNames(groups[1].Files); !reflect.DeepEqual(names, []string{"b.txt", "f.txt", "g.txt"}) {
+		t.Errorf("Expected [b.txt f.txt g.txt], got %v", names)
+	}
+
+	for _, g := range groups {
+		for _, f := range g.Files {
+			if want := strings.Contains(f.Path, "library"); f.Reference != want {
+				t.Errorf("Expected Reference to be %t for %s", want, f.Path)
+			}
+		}
+	}
+
+	// Only the candidates are reclaimable, since the references are kept.
+	if groups[0].Reclaimable != 13 || groups[1].Reclaimable != 18 {
+		t.Errorf("Expected 13 and 18 reclaimable bytes, got %d and %d", groups[0].Reclaimable, groups[1].Reclaimable)
+	}
+
+	dupes, err := GetResults(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := baseNames(dupes); !reflect.DeepEqual(names, []string{"e.txt", "f.txt", "g.txt"}) {
+		t.Errorf("Expected only the candidates [e.txt f.txt g.txt], got %v", names)
+	}
+}
+
+func TestGetGroupsCrossRoots(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"disk1/a.txt": "Hello, World!",
+		"disk1/b.txt": "Hello, World!",
+		"disk1/c.txt": "Go rocks!",
+		"disk1/d.txt": "Rust rocks!",
+		"disk2/e.txt": "Go rocks!",
+		"disk2/f.txt": "Rust rocks!",
+		"disk2/g.txt": "Rust rocks!",
+		"disk2/h.txt": "JavaScript rocks!",
+		"disk2/i.txt": "JavaScript rocks!",
+	})
+	disk1, disk2 := filepath.Join(dir, "disk1"), filepath.Join(dir, "disk2")
+
+	groups, err := GetGroups(Cfg{Paths: []string{disk1, disk2}, CrossRoots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicates within a single disk (a, b and h, i) are left out.
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return len(groups[i].Files) < len(groups[j].Files)
+	})
+
+	if names := baseNames(groups[0].Files); !reflect.DeepEqual(names, []string{"c.txt", "e.txt"}) {
+		t.Errorf("Expected [c.txt e.txt], got %v", names)
+	}
+
+	// Once a group spans both disks, duplicates within a disk are part of it as well.
+	if names := baseNames(groups[1].Files); !reflect.DeepEqual(names, []string{"d.txt", "f.txt", "g.txt"}) {
+		t.Errorf("Expected [d.txt f.txt g.txt], got %v", names)
+	}
+
+	for _, g := range groups {
+		for _, f := range g.Files {
+			if f.Root != filepath.Dir(f.Path) {
+				t.Errorf("Expected root %s for %s, got %s", filepath.Dir(f.Path), f.Path, f.Root)
+			}
+		}
+	}
+}
+
+func TestGetResultsNestedPaths(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt":     "Hello, World!",
+		"sub/b.txt": "Go rocks!",
+	})
+
+	// Files of the nested path must not be reported as duplicates of themselves.
+	dupes, err := GetResults(Cfg{Paths: []string{dir, filepath.Join(dir, "sub"), dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dupes) != 0 {
+		t.Errorf("Expected no duplicates, got %v", dupes)
+	}
+}
+
+func TestGetResultsContextCancelled(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Hello, World!",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dupes, err := GetResultsContext(ctx, Cfg{Paths: []string{dir}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled error, got %v", err)
+	}
+
+	if len(dupes) != 0 {
+		t.Errorf("Expected no duplicates after cancelling, got %v", dupes)
+	}
+}
+
+func TestGetResultsCached(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Hello, World!",
+		"c.txt": "Go rocks!",
+	})
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	keygen := func(path string) (string, error) {
+		calls.Add(1)
+		return Crc32HashKeyGenerator(path)
+	}
+
+	for i := 0; i < 2; i++ {
+		cfg := Cfg{Paths: []string{dir}, KeyGenerator: keygen, Cache: cache, CacheNamespace: "test"}
+		dupes, err := GetResults(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dupes) != 2 {
+			t.Errorf("Expected 2 duplicates, got %v", dupes)
+		}
+	}
+
+	// Second search must reuse all keys from the first one.
+	if calls.Load() != 3 {
+		t.Errorf("Expected key generator to be called 3 times, got %d", calls.Load())
+	}
+}
+
+func TestGetGroupsHardlinks(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"c.txt": "Go rocks!",
+		"d.txt": "Go rocks!",
+	})
+
+	// b.txt and sub/e.txt point to the same inode as a.txt, so there is nothing to reclaim.
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.txt", "sub/e.txt"} {
+		if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, name)); err != nil {
+			t.Skipf("Hardlinks not supported: %v", err)
+		}
+	}
+
+	dupes, err := GetResults(Cfg{Paths: []string{dir}, ReportHardlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := baseNames(dupes); !reflect.DeepEqual(names, []string{"c.txt", "d.txt"}) {
+		t.Errorf("Expected [c.txt d.txt], got %v", names)
+	}
+
+	groups, err := GetGroups(Cfg{Paths: []string{dir}, ReportHardlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	// Hardlink groups are reported once the search is done, so they come last.
+	links := groups[1]
+	if !links.Hardlinked || links.Reclaimable != 0 {
+		t.Errorf("Expected hardlinked group without reclaimable bytes, got %+v", links)
+	}
+
+	if names := baseNames(links.Files); !reflect.DeepEqual(names, []string{"a.txt", "b.txt", "e.txt"}) {
+		t.Errorf("Expected [a.txt b.txt e.txt], got %v", names)
+	}
+}
+
+func TestGetResultsUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("Permissions are not enforced for root")
+	}
+
+	dir := createTempTree(t, map[string]string{
+		"a.txt":        "Hello, World!",
+		"b.txt":        "Hello, World!",
+		"locked/c.txt": "Hello, World!",
+	})
+
+	locked := filepath.Join(dir, "locked")
+	if err := os.Chmod(locked, 0o000); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+
+	dupes, err := GetResults(Cfg{Paths: []string{dir}})
+
+	var scanErrs *ScanErrors
+	if !errors.As(err, &scanErrs) || len(scanErrs.Errors) != 1 || scanErrs.Errors[0].Path != locked {
+		t.Errorf("Expected one ScanError for the locked dir, got %v", err)
+	}
+
+	if names := baseNames(dupes); !reflect.DeepEqual(names, []string{"a.txt", "b.txt"}) {
+		t.Errorf("Expected [a.txt b.txt], got %v", names)
+	}
+}
+
+func TestGetResultsProgress(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Hello, World!",
+		"c.txt": "Go rocks!",
+	})
+
+	var snapshots []Progress
+	cfg := Cfg{
+		Paths:            []string{dir},
+		ProgressInterval: time.Millisecond,
+		Progress: func(p Progress) {
+			snapshots = append(snapshots, p)
+		},
+	}
+
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) == 0 {
+		t.Fatal("Expected progress hook to be called")
+	}
+
+	last := snapshots[len(snapshots)-1]
+	if !last.Done || last.Stage != StageHash {
+		t.Errorf("Expected last snapshot to be done, got %+v", last)
+	}
+
+	if last.FilesFound != 3 || last.FilesHashed != 3 || last.BytesHashed != 35 || last.BytesRead != 35 || last.Groups != 1 {
+		t.Errorf("Expected 3 files with 35 bytes hashed and read and 1 group, got %+v", last)
+	}
+
+	// Staged, the totals are only final once the partial hash collisions are queued.
+	snapshots = nil
+	cfg.Staged = true
+	if _, err := GetResults(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range snapshots {
+		if s.Stage == StageHash && s.FilesQueued != 2 {
+			t.Errorf("Expected 2 queued files once final, got %+v", s)
+		}
+	}
+
+	last = snapshots[len(snapshots)-1]
+	if last.PartialQueued != 2 || last.PartialHashed != 2 || last.FilesHashed != 2 {
+		t.Errorf("Expected 2 files partially hashed and hashed, got %+v", last)
+	}
+}
+
+func TestGetResultsLowWorkers(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("a/%d.txt", i)] = "Hello, World!"
+		files[fmt.Sprintf("b/%d.txt", i)] = fmt.Sprintf("Go rocks %d times!", i%5)
+	}
+	dir := createTempTree(t, files)
+	paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	for _, cfg := range []Cfg{
+		{Paths: paths},                         // defaults on a single CPU
+		{Paths: paths, Workers: 1, Walkers: 1}, // walkers and hashers of one goroutine each
+		{Paths: paths, Workers: 1, Walkers: 1, Staged: true},
+		{Paths: paths, Workers: 1, Walkers: 2, Verify: true},
+	} {
+		done := make(chan struct{})
+		var dupes []File
+		var err error
+
+		go func() {
+			dupes, err = GetResults(cfg)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Search with %d workers and %d walkers (staged: %t) deadlocked", cfg.Workers, cfg.Walkers, cfg.Staged)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dupes) != 100 {
+			t.Errorf("Expected 100 duplicates, got %d", len(dupes))
+		}
+	}
+}
+
+func TestStreamGroupsSlowConsumer(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = fmt.Sprintf("Group %d", i%10)
+	}
+	dir := createTempTree(t, files)
+
+	// Unbuffered and only read after a delay, so every stage of the search backs up.
+	updates := make(chan GroupUpdate)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamGroups(Cfg{Paths: []string{dir}, Workers: 1, Walkers: 1}, updates)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	groups := 0
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				if err := <-errChan; err != nil {
+					t.Fatal(err)
+				}
+				if groups != 10 {
+					t.Errorf("Expected 10 groups, got %d", groups)
+				}
+				return
+			}
+			if u.Kind == GroupCreated {
+				groups++
+			}
+		case <-timeout:
+			t.Fatal("Search with a slow consumer deadlocked")
+		}
+	}
+}
+
+func TestGetGroupsMemoryLimit(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 30; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = fmt.Sprintf("Group %d", i%10)
+	}
+	files["unique.txt"] = "Go rocks!"
+	dir := createTempTree(t, files)
+
+	for _, staged := range []bool{false, true} {
+		spillDir := t.TempDir()
+		groups, err := GetGroups(Cfg{Paths: []string{dir}, Staged: staged, MemoryLimit: 1024, SpillDir: spillDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(groups) != 10 {
+			t.Fatalf("Expected 10 groups (staged: %t), got %d", staged, len(groups))
+		}
+
+		for _, g := range groups {
+			if len(g.Files) != 3 {
+				t.Errorf("Expected 3 files in group %d (staged: %t), got %v", g.ID, staged, baseNames(g.Files))
+			}
+		}
+
+		if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+			t.Errorf("Expected all spilled files to be removed (staged: %t), got %d", staged, len(entries))
+		}
+	}
+}
+
+func TestGetGroupsFailedSpill(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = "Hello, World!"
+	}
+	dir := createTempTree(t, files)
+
+	// The search stops with the error of the spill instead of indexing the rest in memory.
+	for _, staged := range []bool{false, true} {
+		cfg := Cfg{Paths: []string{dir}, Staged: staged, MemoryLimit: 1024, SpillDir: filepath.Join(dir, "missing")}
+		if _, err := GetGroups(cfg); !errors.Is(err, fs.ErrNotExist) || errors.Is(err, context.Canceled) {
+			t.Errorf("Expected only the spill error (staged: %t), got %v", staged, err)
+		}
+	}
+}
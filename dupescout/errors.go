@@ -0,0 +1,107 @@
+package dupescout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// Operations during which a ScanError can occur.
+const (
+	OpPath   = "path"   // Sanitizing one of the paths to search in.
+	OpWalk   = "walk"   // Reading a directory.
+	OpStat   = "stat"   // Reading the file info of a file.
+	OpKey    = "key"    // Generating the key of a file.
+	OpVerify = "verify" // Comparing the contents of two files.
+	OpWatch  = "watch"  // Watching a directory for changes, see Watch.
+)
+
+// ScanError describes a failure for a single path that didn't stop the search, e.g. a
+// directory that can't be read due to missing permissions or a file that vanished
+// while it was being hashed.
+type ScanError struct {
+	Path string // Path that caused the error.
+	Op   string // Operation that failed, one of the Op constants.
+	Err  error  // Underlying error.
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanErrors is returned along with the results when one or more ScanErrors occurred
+// during the search, which can be inspected with errors.As.
+//
+//	var scanErrs *dupescout.ScanErrors
+//	if errors.As(err, &scanErrs) {
+//		for _, e := range scanErrs.Errors {
+//			log.Printf("skipped %s (%s): %v", e.Path, e.Op, e.Err)
+//		}
+//	}
+type ScanErrors struct {
+	Errors []*ScanError
+}
+
+func (e *ScanErrors) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d paths could not be searched:\n%s", len(e.Errors), strings.Join(msgs, "\n"))
+}
+
+func (e *ScanErrors) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Collects the ScanErrors of a search from multiple workers.
+type scanErrors struct {
+	mu     sync.Mutex
+	errs   []*ScanError
+	report func(*ScanError) // called with each error instead of collecting it when set
+}
+
+func (se *scanErrors) add(path, op string, err error) {
+	if se.report != nil {
+		se.report(&ScanError{Path: path, Op: op, Err: err})
+		return
+	}
+
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.errs = append(se.errs, &ScanError{Path: path, Op: op, Err: err})
+}
+
+// Returns the collected errors as ScanErrors, or nil if none occurred.
+func (se *scanErrors) err() error {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	if len(se.errs) == 0 {
+		return nil
+	}
+	return &ScanErrors{Errors: se.errs}
+}
+
+// Records the provided error as a ScanError if the search can continue without the path,
+// which is the case when it can't be accessed or no longer exists.
+//
+// Returns the error as is if the search must be stopped, nil otherwise.
+func (se *scanErrors) recover(path, op string, err error) error {
+	if !errors.Is(err, fs.ErrPermission) && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	se.add(path, op, err)
+	return nil
+}
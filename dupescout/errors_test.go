@@ -0,0 +1,44 @@
+package dupescout
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestScanErrorsRecover(t *testing.T) {
+	se := &scanErrors{}
+
+	if err := se.recover("/a", OpWalk, fs.ErrPermission); err != nil {
+		t.Errorf("Expected permission error to be recovered, got %v", err)
+	}
+
+	if err := se.recover("/b", OpKey, &fs.PathError{Op: "open", Path: "/b", Err: fs.ErrNotExist}); err != nil {
+		t.Errorf("Expected vanished file error to be recovered, got %v", err)
+	}
+
+	other := errors.New("ffprobe not found")
+	if err := se.recover("/c", OpKey, other); err != other {
+		t.Errorf("Expected other errors to be returned as is, got %v", err)
+	}
+
+	err := se.err()
+
+	var scanErrs *ScanErrors
+	if !errors.As(err, &scanErrs) || len(scanErrs.Errors) != 2 {
+		t.Fatalf("Expected ScanErrors with 2 errors, got %v", err)
+	}
+
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || scanErr.Path != "/a" || scanErr.Op != OpWalk {
+		t.Errorf("Expected first ScanError to be for /a, got %v", scanErr)
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Expected underlying errors to be inspectable with errors.Is")
+	}
+
+	if (&scanErrors{}).err() != nil {
+		t.Error("Expected nil error without any ScanErrors")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package dupescout
+
+import "io/fs"
+
+// Device and inode numbers are not available on this platform.
+func fileID(fi fs.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
+
+// Hardlinks can't be detected without inode numbers, so every file is treated as unique.
+func fileLinks(fi fs.FileInfo) uint64 {
+	return 1
+}
+
+// Owners are not available on this platform.
+func fileOwner(fi fs.FileInfo) (uid, gid uint32) {
+	return 0, 0
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package dupescout
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Returns the device and inode numbers of the provided file info.
+func fileID(fi fs.FileInfo) (dev, ino uint64) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino)
+	}
+	return 0, 0
+}
+
+// Returns the number of hardlinks of the provided file info.
+func fileLinks(fi fs.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
+
+// Returns the user and group ids of the owner of the provided file info.
+func fileOwner(fi fs.FileInfo) (uid, gid uint32) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid
+	}
+	return 0, 0
+}
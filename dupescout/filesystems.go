@@ -0,0 +1,53 @@
+package dupescout
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// Returns the device of the provided path, 0 if it can't be determined.
+func pathDev(path string) uint64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+
+	dev, _ := fileID(fi)
+	return dev
+}
+
+// Checks if the provided path should be skipped based on the filesystem filters.
+//
+// The rootDev is the device of the path being searched, only used when OneFileSystem is set.
+// Filesystem types are looked up once per device and cached in `dup.fsTypes`.
+func (dup *dupescout) skipFilesystem(path string, fi fs.FileInfo, rootDev uint64) bool {
+	f := &dup.filters
+	dev, _ := fileID(fi)
+
+	if f.OneFileSystem && dev != rootDev {
+		return true
+	}
+
+	if len(f.FsTypesInclude) == 0 && len(f.FsTypesExclude) == 0 {
+		return false
+	}
+
+	typ, ok := dup.fsTypes.Load(dev)
+	if !ok {
+		var err error
+		typ, err = fsType(path, dev)
+		if err != nil {
+			return false // Unknown type, let the search handle the path as usual.
+		}
+		dup.fsTypes.Store(dev, typ)
+	}
+
+	return f.skipFsType(typ)
+}
+
+// Helper to create the cache of filesystem types per device.
+func newFsTypes() *xsync.MapOf[uint64, string] {
+	return xsync.NewIntegerMapOf[uint64, string]()
+}
@@ -2,7 +2,9 @@ package dupescout
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"golang.org/x/exp/slices"
@@ -25,35 +27,135 @@ func (fl *FiltersList) Set(val string) error {
 	return nil
 }
 
+// Satisfies the flag.Value interface, each value is compiled as a single regular expression
+// since expressions may contain spaces and commas.
+//
+// `flag.Var(&cfg.PathRegexExclude, "er", "regular expressions of paths to exclude")`
+type RegexList []*regexp.Regexp
+
+func (rl *RegexList) String() string {
+	return ""
+}
+
+func (rl *RegexList) Set(val string) error {
+	re, err := regexp.Compile(val)
+	if err != nil {
+		return err
+	}
+	*rl = append(*rl, re)
+	return nil
+}
+
+// Satisfies the flag.Value interface, each value is a single glob pattern since patterns
+// may contain spaces and commas, e.g. "**/Season */*.mkv".
+//
+// `flag.Var(&cfg.GlobInclude, "ig", "glob patterns of the files to include")`
+type GlobList []string
+
+func (gl *GlobList) String() string {
+	return ""
+}
+
+func (gl *GlobList) Set(val string) error {
+	if err := checkGlob(val); err != nil {
+		return err
+	}
+	*gl = append(*gl, val)
+	return nil
+}
+
+// Reports whether any of the regular expressions matches the provided path.
+func (rl RegexList) match(path string) bool {
+	return slices.ContainsFunc(rl, func(re *regexp.Regexp) bool {
+		return re.MatchString(path)
+	})
+}
+
 type Filters struct {
 	ExtInclude    FiltersList // List of file extensions to include.
 	ExtExclude    FiltersList // List of file extensions to exclude.
 	DirsExclude   FiltersList // List of directories or subdirectories to exclude.
 	SkipSubdirs   bool        // Skip subdirectories.
 	HiddenInclude bool        // Include hidden files and directories.
+
+	// Follow symlinks to files and directories, each directory is only walked once
+	// to prevent loops. Symlinks to files inside the search are never reported as duplicates.
+	FollowSymlinks bool
+
+	OneFileSystem  bool        // Don't descend into directories on other filesystems than the searched path.
+	FsTypesInclude FiltersList // List of filesystem types to include, e.g. ext4, btrfs (Linux only).
+	FsTypesExclude FiltersList // List of filesystem types to exclude, e.g. nfs, cifs, fuse.sshfs (Linux only).
+
+	// Glob patterns of the files to include, matched against their path relative to the
+	// searched path with "/" separators. "**" matches any number of directories, e.g.
+	// "**/Season */*.mkv". Directories are never skipped by these patterns.
+	GlobInclude GlobList
+
+	// Glob patterns of the files and directories to exclude, see GlobInclude. Excluded
+	// directories are not walked at all, e.g. "Movies/**/Extras".
+	GlobExclude GlobList
+
+	// Regular expressions of the files to include, matched against their absolute path.
+	// Directories are never skipped by these expressions.
+	PathRegexInclude RegexList
+
+	// Regular expressions of the files and directories to exclude, matched against their
+	// absolute path, e.g. `-sample\.mkv$` or `\.partial~$`.
+	PathRegexExclude RegexList
+
+	MinSize Size // Minimum size of the files to include, e.g. 100MiB. 0 for no minimum.
+	MaxSize Size // Maximum size of the files to include, e.g. 4GiB. 0 for no maximum.
 }
 
 // Beauty stringifies the Filters struct.
 func (f *Filters) String() string {
 	return fmt.Sprintf(
-		"\t{\n\t\tSkipSubdirs: %t\n\t\tHiddenInclude: %t\n\t\tExtInclude: %s\n\t\tExtExclude: %s\n\t\tDirsExclude: %s\n\t}",
+		"\t{\n\t\tSkipSubdirs: %t\n\t\tHiddenInclude: %t\n\t\tFollowSymlinks: %t\n\t\tOneFileSystem: %t\n\t\tExtInclude: %s\n\t\tExtExclude: %s\n\t\tDirsExclude: %s\n\t\tGlobInclude: %s\n\t\tGlobExclude: %s\n\t\tPathRegexInclude: %s\n\t\tPathRegexExclude: %s\n\t\tMinSize: %s\n\t\tMaxSize: %s\n\t\tFsTypesInclude: %s\n\t\tFsTypesExclude: %s\n\t}",
 		f.SkipSubdirs,
 		f.HiddenInclude,
+		f.FollowSymlinks,
+		f.OneFileSystem,
 		f.ExtInclude,
 		f.ExtExclude,
 		f.DirsExclude,
+		f.GlobInclude,
+		f.GlobExclude,
+		f.PathRegexInclude,
+		f.PathRegexExclude,
+		f.MinSize,
+		f.MaxSize,
+		f.FsTypesInclude,
+		f.FsTypesExclude,
 	)
 }
 
-// Checks if the provided path should be skipped based on file filters.
+// Checks if the provided path inside the provided searched path should be skipped based
+// on file filters.
 //
 // Assumes that the path is a file.
-func (f *Filters) skipFile(path string) bool {
+func (f *Filters) skipFile(path, root string) bool {
 	fileName := filepath.Base(path)
 	if skipHidden(fileName, f.HiddenInclude) {
 		return true
 	}
 
+	if len(f.GlobInclude) > 0 || len(f.GlobExclude) > 0 {
+		rel := relativePath(path, root)
+		if len(f.GlobInclude) > 0 && !matchAnyGlob(f.GlobInclude, rel) {
+			return true // Skip files not matching any include pattern
+		}
+		if matchAnyGlob(f.GlobExclude, rel) {
+			return true // Skip files matching an exclude pattern
+		}
+	}
+
+	if len(f.PathRegexInclude) > 0 && !f.PathRegexInclude.match(path) {
+		return true // Skip files not matching any include expression
+	}
+	if f.PathRegexExclude.match(path) {
+		return true // Skip files matching an exclude expression
+	}
+
 	ext := strings.ToLower(filepath.Ext(fileName))
 
 	if len(f.ExtInclude) > 0 {
@@ -63,18 +165,128 @@ func (f *Filters) skipFile(path string) bool {
 	return slices.Contains(f.ExtExclude, ext) // Skip files in exclude list
 }
 
-// Checks if the provided path should be skipped based on dir filters.
+// Checks if the provided path inside the provided searched path should be skipped based
+// on dir filters.
 //
 // Assumes that the path is a directory.
-func (f *Filters) skipDir(path string) bool {
+func (f *Filters) skipDir(path, root string) bool {
 	dirName := filepath.Base(path)
 	if f.SkipSubdirs || skipHidden(dirName, f.HiddenInclude) {
 		return true
 	}
 
+	if len(f.GlobExclude) > 0 && matchAnyGlob(f.GlobExclude, relativePath(path, root)) {
+		return true // Skip dirs matching an exclude pattern
+	}
+
+	if f.PathRegexExclude.match(path) {
+		return true // Skip dirs matching an exclude expression
+	}
+
 	return slices.Contains(f.DirsExclude, dirName) // Skip dirs in exclude list
 }
 
+// Checks that the size range is valid and that all glob patterns are well-formed, so
+// that a typo doesn't silently match nothing.
+func (f *Filters) validate() error {
+	if f.MinSize < 0 || f.MaxSize < 0 {
+		return fmt.Errorf("invalid size range %s - %s: sizes can't be negative", f.MinSize, f.MaxSize)
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("invalid size range %s - %s: minimum exceeds maximum", f.MinSize, f.MaxSize)
+	}
+
+	for _, pattern := range append(slices.Clone(f.GlobInclude), f.GlobExclude...) {
+		if err := checkGlob(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that each "/" separated segment of the provided glob pattern is well-formed.
+func checkGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Helper to get the provided path relative to the searched path it was found in, with
+// "/" separators to be matched against glob patterns.
+func relativePath(path, root string) string {
+	rel := strings.TrimPrefix(path, root)
+	return filepath.ToSlash(strings.TrimPrefix(rel, string(filepath.Separator)))
+}
+
+// Reports whether the provided relative path matches any of the provided patterns.
+func matchAnyGlob(patterns []string, rel string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return matchGlob(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+	})
+}
+
+// Reports whether the segments of a path match the segments of a glob pattern, where a
+// "**" segment matches any number of segments (including none) and every other segment
+// is matched with path.Match.
+func matchGlob(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchGlob(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// Checks if a file of the provided size should be skipped, which empty files always are.
+func (f *Filters) skipSize(size int64) bool {
+	return size == 0 || size < int64(f.MinSize) || (f.MaxSize > 0 && size > int64(f.MaxSize))
+}
+
+// Reports whether any of the filesystem filters are set.
+func (f *Filters) filtersFilesystems() bool {
+	return f.OneFileSystem || len(f.FsTypesInclude) > 0 || len(f.FsTypesExclude) > 0
+}
+
+// Checks if a directory on a filesystem of the provided type should be skipped
+// based on the filesystem type filters.
+//
+// A list entry also matches all of its subtypes, e.g. "fuse" matches "fuse.sshfs".
+func (f *Filters) skipFsType(fsType string) bool {
+	if fsType == "" {
+		return false // Unknown type, e.g. not supported on the platform.
+	}
+
+	matches := func(types FiltersList) bool {
+		return slices.ContainsFunc(types, func(t string) bool {
+			return fsType == t || strings.HasPrefix(fsType, t+".")
+		})
+	}
+
+	if len(f.FsTypesInclude) > 0 {
+		return !matches(f.FsTypesInclude) // Skip types not in include list
+	}
+
+	return matches(f.FsTypesExclude) // Skip types in exclude list
+}
+
 // Helper to check if the provided dir or file name is hidden and should be skipped
 // based on the HiddenInclude filter.
 func skipHidden(name string, hiddenInclude bool) bool {
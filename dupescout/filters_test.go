@@ -1,6 +1,7 @@
 package dupescout
 
 import (
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -19,36 +20,72 @@ func TestFiltersListSet(t *testing.T) {
 	}
 }
 
+func TestRegexListSet(t *testing.T) {
+	var rl RegexList
+
+	if err := rl.Set(`-sample\.mkv$`); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Set(`a, b`); err != nil {
+		t.Fatal(err)
+	}
+	if len(rl) != 2 || rl[1].String() != "a, b" {
+		t.Errorf("Expected each value to be a single expression, got %v", rl)
+	}
+
+	if err := rl.Set(`(`); err == nil {
+		t.Error("Expected error for invalid expression")
+	}
+}
+
+func TestGlobListSet(t *testing.T) {
+	var gl GlobList
+
+	if err := gl.Set("**/Season */*.mkv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gl.Set("a,b"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gl, GlobList{"**/Season */*.mkv", "a,b"}) {
+		t.Errorf("Expected each value to be a single pattern, got %v", gl)
+	}
+
+	if err := gl.Set("Movies/[Extras"); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
 func TestSkipFile(t *testing.T) {
 	f := Filters{
 		ExtExclude: []string{".jpg", ".png"},
 	}
 
-	if !f.skipFile("test.jpg") || !f.skipFile("test.png") {
+	if !f.skipFile("test.jpg", "") || !f.skipFile("test.png", "") {
 		t.Error("Expected true, got false")
 	}
 
 	// Hidden files must be skipped by default
-	if !f.skipFile(".vimrc") {
+	if !f.skipFile(".vimrc", "") {
 		t.Error("Expected true, got false")
 	}
 
 	f.HiddenInclude = true
 
-	if f.skipFile(".vimrc") {
+	if f.skipFile(".vimrc", "") {
 		t.Error("Expected false, got true")
 	}
 
 	f.ExtInclude = []string{".txt", ".docx"}
 
-	if f.skipFile("test.txt") || f.skipFile("test.docx") {
+	if f.skipFile("test.txt", "") || f.skipFile("test.docx", "") {
 		t.Error("Expected false, got true")
 	}
 
 	// Even though ".js" files are not explicitly excluded, they will be
 	// skipped if include filters are set and the file extension is not
 	// in the ExtInclude slice.
-	if !f.skipFile("test.js") {
+	if !f.skipFile("test.js", "") {
 		t.Error("Expected true, got false")
 	}
 }
@@ -58,22 +95,22 @@ func TestSkipDir(t *testing.T) {
 		DirsExclude: []string{"node_modules"},
 	}
 
-	if !f.skipDir("node_modules") {
+	if !f.skipDir("node_modules", "") {
 		t.Error("Expected true, got false")
 	}
 
-	if f.skipDir("test") {
+	if f.skipDir("test", "") {
 		t.Error("Expected false, got true")
 	}
 
 	// Hidden directories must be skipped by default
-	if !f.skipDir(".git") {
+	if !f.skipDir(".git", "") {
 		t.Error("Expected true, got false")
 	}
 
 	f.HiddenInclude = true
 
-	if f.skipDir(".git") {
+	if f.skipDir(".git", "") {
 		t.Error("Expected false, got true")
 	}
 
@@ -82,7 +119,145 @@ func TestSkipDir(t *testing.T) {
 	// Even though "test" is not explicitly excluded, it will be
 	// skipped if SkipSubdirs is true, because it prevents the
 	// recursive traversal of any subdirectories.
-	if !f.skipDir("test") {
+	if !f.skipDir("test", "") {
+		t.Error("Expected true, got false")
+	}
+}
+
+func TestSkipGlobs(t *testing.T) {
+	f := Filters{
+		GlobInclude: []string{"**/Season */*.mkv", "*.mkv"},
+		GlobExclude: []string{"Movies/**/Extras", "**/*sample*"},
+	}
+	root := filepath.Join(string(filepath.Separator), "mnt", "media")
+	path := func(rel string) string {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+
+	tcs := []struct {
+		path     string
+		dir      bool
+		expected bool
+	}{
+		{"Shows/Lost/Season 1/e01.mkv", false, false},
+		{"Season 2/e01.mkv", false, false},
+		{"movie.mkv", false, false},
+		{"Movies/movie.mkv", false, true},            // Not matching any include pattern.
+		{"Shows/Lost/Season 1/e01.srt", false, true}, // Not matching any include pattern.
+		{"Shows/Lost/Season 1/sample.mkv", false, true},
+		{"Movies/Extras", true, true}, // "**" also matches no directories at all.
+		{"Movies/Alien/Extras", true, true},
+		{"Movies/Alien/Making of/Extras", true, true},
+		{"Shows/Extras", true, false},
+	}
+
+	for _, tc := range tcs {
+		skip := f.skipFile(path(tc.path), root)
+		if tc.dir {
+			skip = f.skipDir(path(tc.path), root)
+		}
+
+		if skip != tc.expected {
+			t.Errorf("Expected %t for %s, got %t", tc.expected, tc.path, skip)
+		}
+	}
+}
+
+func TestSkipPathRegex(t *testing.T) {
+	var f Filters
+	f.PathRegexInclude.Set(`/Movies/`)
+	f.PathRegexExclude.Set(`-sample\.mkv$`)
+	f.PathRegexExclude.Set(`\.partial~$`)
+	f.PathRegexExclude.Set(`/Trailers$`)
+
+	tcs := []struct {
+		path     string
+		dir      bool
+		expected bool
+	}{
+		{"/mnt/Movies/alien.mkv", false, false},
+		{"/mnt/Movies/alien-sample.mkv", false, true},
+		{"/mnt/Movies/alien.mkv.partial~", false, true},
+		{"/mnt/Shows/lost.mkv", false, true}, // Not matching any include expression.
+		{"/mnt/Shows", true, false},          // Directories are never skipped by includes.
+		{"/mnt/Movies/Trailers", true, true},
+	}
+
+	for _, tc := range tcs {
+		skip := f.skipFile(tc.path, "/mnt")
+		if tc.dir {
+			skip = f.skipDir(tc.path, "/mnt")
+		}
+
+		if skip != tc.expected {
+			t.Errorf("Expected %t for %s, got %t", tc.expected, tc.path, skip)
+		}
+	}
+}
+
+func TestFiltersValidate(t *testing.T) {
+	if err := (&Filters{GlobInclude: []string{"**/Season */*.mkv"}}).validate(); err != nil {
+		t.Errorf("Expected valid pattern, got %v", err)
+	}
+
+	if err := (&Filters{GlobExclude: []string{"Movies/[Extras"}}).validate(); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+
+	if err := (&Filters{MinSize: 100 << 20, MaxSize: 1 << 20}).validate(); err == nil {
+		t.Error("Expected error for minimum size exceeding maximum size")
+	}
+
+	if err := (&Filters{MinSize: 100 << 20}).validate(); err != nil {
+		t.Errorf("Expected valid size range without maximum, got %v", err)
+	}
+}
+
+func TestSkipSize(t *testing.T) {
+	f := Filters{}
+
+	// Empty files are always skipped.
+	if !f.skipSize(0) || f.skipSize(1) {
+		t.Error("Expected only empty files to be skipped without a size range")
+	}
+
+	f.MinSize = 1 << 10
+	f.MaxSize = 1 << 20
+
+	if !f.skipSize(1<<10-1) || !f.skipSize(1<<20+1) {
+		t.Error("Expected true, got false")
+	}
+
+	if f.skipSize(1<<10) || f.skipSize(1<<20) {
+		t.Error("Expected false, got true")
+	}
+}
+
+func TestSkipFsType(t *testing.T) {
+	f := Filters{
+		FsTypesExclude: []string{"nfs", "fuse"},
+	}
+
+	if !f.skipFsType("nfs") || !f.skipFsType("fuse.sshfs") {
+		t.Error("Expected true, got false")
+	}
+
+	if f.skipFsType("ext4") || f.skipFsType("nfs4") {
+		t.Error("Expected false, got true")
+	}
+
+	// Unknown types are never skipped.
+	if f.skipFsType("") {
+		t.Error("Expected false, got true")
+	}
+
+	f.FsTypesInclude = []string{"ext4", "btrfs"}
+
+	if f.skipFsType("ext4") || f.skipFsType("btrfs") {
+		t.Error("Expected false, got true")
+	}
+
+	if !f.skipFsType("xfs") {
 		t.Error("Expected true, got false")
 	}
 }
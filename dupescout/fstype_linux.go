@@ -0,0 +1,143 @@
+package dupescout
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Filesystem magic numbers as reported by statfs, see statfs(2).
+var fsMagicNames = map[uint32]string{
+	0x0000ef53: "ext4", // Shared by ext2, ext3 and ext4.
+	0x9123683e: "btrfs",
+	0x58465342: "xfs",
+	0x2fc12fc1: "zfs",
+	0xf2f52010: "f2fs",
+	0x3153464a: "jfs",
+	0x52654973: "reiserfs",
+	0x00004d44: "msdos",
+	0x5346544e: "ntfs",
+	0x2011bab0: "exfat",
+	0x00004244: "hfs",
+	0x0000482b: "hfsplus",
+	0x00009660: "iso9660",
+	0x73717368: "squashfs",
+	0x794c7630: "overlay",
+	0x0000f15f: "ecryptfs",
+	0x00006969: "nfs",
+	0x0000517b: "smb",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+	0x00c36400: "ceph",
+	0x01161970: "gfs2",
+	0x7461636f: "ocfs2",
+	0x6b414653: "afs",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0x01021994: "tmpfs",
+	0x858458f6: "ramfs",
+	0x958458f6: "hugetlbfs",
+	0x00000187: "autofs",
+	0x00009fa0: "proc",
+	0x62656572: "sysfs",
+	0x00001cd1: "devpts",
+	0x0027e0eb: "cgroup",
+	0x63677270: "cgroup2",
+	0x64626720: "debugfs",
+	0x74726163: "tracefs",
+	0x73636673: "securityfs",
+	0x62656570: "configfs",
+	0x42494e4d: "binfmt_misc",
+	0x19800202: "mqueue",
+	0xcafe4a11: "bpf",
+	0x6e736673: "nsfs",
+	0x6165676c: "pstore",
+	0xde5e81e4: "efivarfs",
+}
+
+// Returns the type of the filesystem the provided path is located on, e.g. "ext4",
+// "nfs" or "fuse.sshfs".
+func fsType(path string, dev uint64) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", err
+	}
+
+	name, ok := fsMagicNames[uint32(st.Type)]
+	if !ok {
+		name = fmt.Sprintf("0x%x", uint32(st.Type))
+	}
+
+	// All fuse filesystems share the same magic number, the actual type (e.g. fuse.sshfs)
+	// is only available in the mount table.
+	if name == "fuse" {
+		if mountType, ok := mountFsType(dev); ok {
+			return mountType, nil
+		}
+	}
+
+	return name, nil
+}
+
+// Looks up the filesystem type of the mount with the provided device in /proc/self/mountinfo.
+func mountFsType(dev uint64) (string, bool) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	device := devNumber(dev)
+
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[2] != device {
+			continue
+		}
+
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) {
+				return fields[i+1], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Returns the provided device as "major:minor", as used by /proc and /sys.
+func devNumber(dev uint64) string {
+	// Encoding of dev_t in glibc, see gnu_dev_major and gnu_dev_minor.
+	major := ((dev >> 8) & 0xfff) | ((dev >> 32) &^ 0xfff)
+	minor := (dev & 0xff) | ((dev >> 12) &^ 0xff)
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// Directory of the block devices by device number, replaced in tests.
+var sysDevBlock = "/sys/dev/block"
+
+// Reports whether the provided device is a rotational disk (HDD) according to its
+// queue/rotational attribute in sysfs.
+//
+// Partitions don't have a queue, so the attribute of their disk is used instead. Devices
+// without a block device (e.g. network filesystems, btrfs subvolumes) are never rotational.
+func isRotational(dev uint64) bool {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysDevBlock, devNumber(dev)))
+	if err != nil {
+		return false
+	}
+
+	for _, dir := range []string{dir, filepath.Dir(dir)} {
+		b, err := os.ReadFile(filepath.Join(dir, "queue", "rotational"))
+		if err == nil {
+			return strings.TrimSpace(string(b)) == "1"
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package dupescout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFsType(t *testing.T) {
+	fi, err := os.Stat("/proc")
+	if err != nil {
+		t.Skip("/proc not available")
+	}
+
+	dev, _ := fileID(fi)
+	typ, err := fsType("/proc", dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if typ != "proc" {
+		t.Errorf("Expected proc, got %s", typ)
+	}
+}
+
+func TestSkipFilesystem(t *testing.T) {
+	proc, err := os.Stat("/proc")
+	if err != nil {
+		t.Skip("/proc not available")
+	}
+
+	dir := t.TempDir()
+	rootDev := pathDev(dir)
+	if procDev, _ := fileID(proc); procDev == rootDev {
+		t.Skip("/proc is on the same device as the temp dir")
+	}
+
+	dup := &dupescout{fsTypes: newFsTypes()}
+	if dup.skipFilesystem("/proc", proc, rootDev) {
+		t.Error("Expected /proc to not be skipped without filesystem filters")
+	}
+
+	dup.filters.OneFileSystem = true
+	if !dup.skipFilesystem("/proc", proc, rootDev) {
+		t.Error("Expected /proc to be skipped when staying on the device of the root")
+	}
+
+	dup.filters = Filters{FsTypesExclude: []string{"proc"}}
+	if !dup.skipFilesystem("/proc", proc, rootDev) {
+		t.Error("Expected /proc to be skipped when excluding its filesystem type")
+	}
+
+	if typ, _ := dup.fsTypes.Load(pathDev("/proc")); typ != "proc" {
+		t.Errorf("Expected filesystem type of /proc to be cached, got %q", typ)
+	}
+}
+
+// Helper to create a fake /sys/dev/block with the provided disks and their rotational
+// attribute, each with a single partition.
+func fakeSysDevBlock(t *testing.T, disks map[string]bool) {
+	t.Helper()
+	root := t.TempDir()
+	devBlock := filepath.Join(root, "dev", "block")
+	if err := os.MkdirAll(devBlock, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for device, rotational := range disks {
+		name := "disk" + strings.ReplaceAll(device, ":", "-")
+		disk := filepath.Join(root, "devices", name)
+		if err := os.MkdirAll(filepath.Join(disk, "queue"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Join(disk, name+"p1"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		value := "0\n"
+		if rotational {
+			value = "1\n"
+		}
+		if err := os.WriteFile(filepath.Join(disk, "queue", "rotational"), []byte(value), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// The partition is the next minor number after its disk.
+		major, minor, _ := strings.Cut(device, ":")
+		n, _ := strconv.Atoi(minor)
+		partition := fmt.Sprintf("%s:%d", major, n+1)
+
+		if err := os.Symlink(disk, filepath.Join(devBlock, device)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(disk, name+"p1"), filepath.Join(devBlock, partition)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := sysDevBlock
+	sysDevBlock = devBlock
+	t.Cleanup(func() { sysDevBlock = old })
+}
+
+func TestIsRotational(t *testing.T) {
+	fakeSysDevBlock(t, map[string]bool{"8:0": true, "259:0": false})
+
+	for _, tc := range []struct {
+		dev        uint64
+		rotational bool
+	}{
+		{8 << 8, true},      // sda
+		{8<<8 | 1, true},    // sda1, inherits from its disk
+		{259 << 8, false},   // nvme0n1
+		{259<<8 | 1, false}, // nvme0n1p1
+		{42, false},         // anonymous device, e.g. btrfs subvolume
+	} {
+		if got := isRotational(tc.dev); got != tc.rotational {
+			t.Errorf("Expected rotational to be %t for %s, got %t", tc.rotational, devNumber(tc.dev), got)
+		}
+	}
+}
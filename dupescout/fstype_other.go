@@ -0,0 +1,13 @@
+//go:build !linux
+
+package dupescout
+
+// Filesystem types are only detected on Linux, so filesystem type filters never match.
+func fsType(path string, dev uint64) (string, error) {
+	return "", nil
+}
+
+// Rotational disks are only detected on Linux.
+func isRotational(dev uint64) bool {
+	return false
+}
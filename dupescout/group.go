@@ -0,0 +1,153 @@
+package dupescout
+
+import (
+	"io/fs"
+	"time"
+)
+
+// A file found during the search.
+type File struct {
+	Path    string      // Absolute path of the file.
+	Size    int64       // Size of the file in bytes.
+	ModTime time.Time   // Last modification time of the file.
+	Mode    fs.FileMode // Mode and permission bits of the file.
+	UID     uint32      // User id of the owner, 0 if not supported by the platform.
+	GID     uint32      // Group id of the owner, 0 if not supported by the platform.
+	Dev     uint64      // Device number of the file, 0 if not supported by the platform.
+	Inode   uint64      // Inode number of the file, 0 if not supported by the platform.
+	Key     string      // Key generated for the file, empty for files that were never hashed (e.g. hardlinks).
+
+	// Entry of Cfg.Paths or Cfg.References the file was found in.
+	Root string
+
+	// Whether the file was found in Cfg.References, meaning it's to be kept and never deleted.
+	Reference bool
+}
+
+// Creates a File from the provided path and its file info.
+func newFile(path string, fi fs.FileInfo) File {
+	dev, ino := fileID(fi)
+	uid, gid := fileOwner(fi)
+	return File{
+		Path:    path,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		Mode:    fi.Mode(),
+		UID:     uid,
+		GID:     gid,
+		Dev:     dev,
+		Inode:   ino,
+	}
+}
+
+// Reports whether the file is the provided file as it is now, based on its inode, size
+// and modification time.
+func (f File) unchanged(now File) bool {
+	return f.Dev == now.Dev && f.Inode == now.Inode && f.Size == now.Size && f.ModTime.Equal(now.ModTime)
+}
+
+// A group of duplicate files which share the same key.
+type Group struct {
+	ID          int    // Unique id of the group within a search, in order of creation starting at 0.
+	Key         string // Key generated by the KeyGeneratorFunc that all files in the group share.
+	Files       []File // Files of the group in the order they were found.
+	Reclaimable int64  // Bytes that would be freed by keeping only the largest file, or only the references, of the group.
+
+	// Whether the files are hardlinks of the same inode, meaning they are already deduplicated
+	// and deleting any of them frees no space. Only reported when Cfg.ReportHardlinks is set.
+	Hardlinked bool
+
+	// Whether the first file is the target of symlinks found in the search, which make up
+	// the rest of the files. Only reported when Cfg.ReportSymlinks is set.
+	Symlinked bool
+
+	// Whether the previous search recorded in Cfg.Snapshot found no group with the same key.
+	New bool
+}
+
+// Adds the provided files to the group and updates the reclaimable bytes.
+func (g *Group) add(files ...File) {
+	g.Files = append(g.Files, files...)
+	if g.Hardlinked || g.Symlinked {
+		return // All files share the same data, so nothing can be reclaimed.
+	}
+
+	var total, largest, candidates int64
+	references := false
+	for _, f := range g.Files {
+		total += f.Size
+		largest = max(largest, f.Size)
+		if f.Reference {
+			references = true
+		} else {
+			candidates += f.Size
+		}
+	}
+
+	// The references are kept instead of the largest file, so every candidate can be deleted.
+	if references {
+		g.Reclaimable = candidates
+		return
+	}
+	g.Reclaimable = total - largest
+}
+
+// Returns the paths of all files in the group.
+func (g *Group) Paths() []string {
+	return filePaths(g.Files)
+}
+
+// Reports whether the files of the group are hardlinks or symlinks of the same file, which
+// are already deduplicated, so deleting any of them frees no space.
+func (g *Group) Deduplicated() bool {
+	return g.Hardlinked || g.Symlinked
+}
+
+type GroupUpdateKind int
+
+const (
+	GroupCreated   GroupUpdateKind = iota // A new group was created with its files so far, usually its first two.
+	MemberAdded                           // A file was added to an existing group.
+	HardlinksFound                        // A group of hardlinks of the same inode was found, see Group.Hardlinked.
+	SymlinksFound                         // A group of symlinks to the same file was found, see Group.Symlinked.
+)
+
+// Describes a change to a group, which are streamed by StreamGroups as they happen.
+//
+// Applying all updates in order yields the same groups as returned by GetGroups.
+type GroupUpdate struct {
+	Kind  GroupUpdateKind
+	Group int    // ID of the created or updated group.
+	Key   string // Key of the created or updated group.
+	Files []File // Files that were added to the group.
+	New   bool   // Whether the group is new since the previous search, see Group.New. Only set for GroupCreated.
+}
+
+// Reports whether the update found a group of hardlinks or symlinks, see Group.Deduplicated.
+func (u GroupUpdate) Deduplicated() bool {
+	return u.Kind == HardlinksFound || u.Kind == SymlinksFound
+}
+
+// Applies the update to the provided groups, which are expected to be indexed by their ID.
+func (u GroupUpdate) apply(groups []Group) []Group {
+	switch u.Kind {
+	case GroupCreated:
+		groups = append(groups, Group{ID: u.Group, Key: u.Key, New: u.New})
+	case HardlinksFound:
+		groups = append(groups, Group{ID: u.Group, Key: u.Key, Hardlinked: true})
+	case SymlinksFound:
+		groups = append(groups, Group{ID: u.Group, Key: u.Key, Symlinked: true})
+	}
+
+	groups[u.Group].add(u.Files...)
+	return groups
+}
+
+// Helper to get the paths of the provided files.
+func filePaths(files []File) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
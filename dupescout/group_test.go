@@ -0,0 +1,55 @@
+package dupescout
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupUpdateApply(t *testing.T) {
+	a := File{Path: "/a", Size: 10}
+	b := File{Path: "/b", Size: 10}
+	c := File{Path: "/c", Size: 30}
+	d := File{Path: "/d", Size: 5}
+
+	updates := []GroupUpdate{
+		{Kind: GroupCreated, Group: 0, Key: "x", Files: []File{a, b}},
+		{Kind: GroupCreated, Group: 1, Key: "y", Files: []File{c, d}},
+		{Kind: MemberAdded, Group: 0, Key: "x", Files: []File{c}},
+	}
+
+	var groups []Group
+	for _, u := range updates {
+		groups = u.apply(groups)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	if !reflect.DeepEqual(groups[0].Paths(), []string{"/a", "/b", "/c"}) {
+		t.Errorf("Expected [/a /b /c], got %v", groups[0].Paths())
+	}
+
+	// Largest file is kept, so only the smaller ones are reclaimable.
+	if groups[0].Reclaimable != 20 {
+		t.Errorf("Expected 20 reclaimable bytes, got %d", groups[0].Reclaimable)
+	}
+
+	if groups[1].Key != "y" || groups[1].Reclaimable != 5 {
+		t.Errorf("Expected group with key y and 5 reclaimable bytes, got %+v", groups[1])
+	}
+}
+
+func TestGroupDeduplicated(t *testing.T) {
+	a := File{Path: "/a", Size: 10}
+	b := File{Path: "/b", Size: 10}
+
+	for kind, expected := range map[GroupUpdateKind]bool{GroupCreated: false, HardlinksFound: true, SymlinksFound: true} {
+		u := GroupUpdate{Kind: kind, Group: 0, Key: "x", Files: []File{a, b}}
+		groups := u.apply(nil)
+
+		if u.Deduplicated() != expected || groups[0].Deduplicated() != expected {
+			t.Errorf("Expected deduplicated to be %t for kind %d", expected, kind)
+		}
+	}
+}
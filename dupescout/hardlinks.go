@@ -0,0 +1,54 @@
+package dupescout
+
+import (
+	"fmt"
+
+	"github.com/puzpuzpuz/xsync/v2"
+	"golang.org/x/exp/slices"
+)
+
+// Keeps track of files with more than one hardlink, so that paths pointing to the same
+// inode are collapsed into the first path found and never reported as duplicates.
+type hardlinks struct {
+	m *xsync.MapOf[string, []File] // "dev:ino" -> all paths found for the inode
+}
+
+func newHardlinks() *hardlinks {
+	return &hardlinks{m: xsync.NewMapOf[[]File]()}
+}
+
+// Helper to get the identifier of the inode of the provided file.
+func inodeKey(f File) string {
+	return fmt.Sprintf("%d:%d", f.Dev, f.Inode)
+}
+
+// Records the provided file and reports whether its inode was already found under
+// another path, in which case the file must be skipped.
+func (h *hardlinks) seen(f File) bool {
+	seen := false
+	h.m.Compute(inodeKey(f), func(files []File, loaded bool) ([]File, bool) {
+		seen = loaded
+		return append(files, f), false
+	})
+	return seen
+}
+
+// Forgets the provided path of its inode, so that it's no longer skipped if found again.
+func (h *hardlinks) forget(f File) {
+	h.m.Compute(inodeKey(f), func(files []File, loaded bool) ([]File, bool) {
+		files = slices.DeleteFunc(slices.Clone(files), func(lf File) bool { return lf.Path == f.Path })
+		return files, len(files) == 0
+	})
+}
+
+// Returns the paths of all inodes that were found more than once, grouped by inode.
+func (h *hardlinks) groups() map[string][]File {
+	groups := map[string][]File{}
+	h.m.Range(func(key string, files []File) bool {
+		if len(files) > 1 {
+			groups[key] = files
+		}
+		return true
+	})
+	return groups
+}
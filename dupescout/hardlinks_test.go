@@ -0,0 +1,28 @@
+package dupescout
+
+import "testing"
+
+func TestHardlinksSeen(t *testing.T) {
+	h := newHardlinks()
+
+	a := File{Path: "/a", Dev: 1, Inode: 10}
+	b := File{Path: "/b", Dev: 1, Inode: 10}
+	c := File{Path: "/c", Dev: 2, Inode: 10} // Same inode number on another device.
+
+	if h.seen(a) {
+		t.Error("Expected first path of an inode to not be seen")
+	}
+
+	if !h.seen(b) {
+		t.Error("Expected second path of an inode to be seen")
+	}
+
+	if h.seen(c) {
+		t.Error("Expected inode on another device to not be seen")
+	}
+
+	groups := h.groups()
+	if len(groups) != 1 || len(groups[inodeKey(a)]) != 2 {
+		t.Errorf("Expected one group with 2 paths, got %v", groups)
+	}
+}
@@ -1,13 +1,20 @@
 package dupescout
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"hash/crc32"
+	"hash/crc64"
+	"hash/fnv"
 	"io"
 	"os"
+	"reflect"
+	"sync/atomic"
 )
 
 var (
@@ -26,7 +33,73 @@ var (
 // generate a key based on the file name, size, etc.
 type KeyGeneratorFunc func(path string) (string, error)
 
-func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
+// Number of bytes hashed from the start of a file by the non-full hash key generators.
+const DefaultHashPrefixSize = 16 * 1024
+
+// Options of a KeyGeneratorFunc created with NewHashKeyGenerator.
+type HashOptions struct {
+	PrefixSize int64 // Bytes hashed from the start of the file, defaults to DefaultHashPrefixSize.
+	Full       bool  // Hash the entire file contents, PrefixSize is ignored if set.
+}
+
+// Hash constructors that can be passed to NewHashKeyGenerator, by name.
+//
+// Non-cryptographic hashes (crc32, crc64, fnv128a) are the fastest, while the
+// cryptographic ones (md5, sha1, sha256, sha512) make collisions practically impossible.
+var HashFuncs = map[string]func() hash.Hash{
+	"crc32":   func() hash.Hash { return crc32.NewIEEE() },
+	"crc64":   func() hash.Hash { return crc64.New(crc64Table) },
+	"fnv128a": fnv.New128a,
+	"md5":     md5.New,
+	"sha1":    sha1.New,
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Creates a KeyGeneratorFunc that hashes the file contents with a new hash from the provided
+// constructor, e.g. sha512.New or one of HashFuncs.
+//
+// All generators created by this function share the same name, so Cfg.CacheNamespace must
+// be set when using them with a Cache, otherwise the search fails with ErrCacheNamespace.
+func NewHashKeyGenerator(newHash func() hash.Hash, opts HashOptions) KeyGeneratorFunc {
+	size := opts.PrefixSize
+	if size <= 0 {
+		size = DefaultHashPrefixSize
+	}
+	if opts.Full {
+		size = -1
+	}
+
+	return func(path string) (string, error) {
+		return generateFileHash(path, newHash(), size, nil)
+	}
+}
+
+// Built-in KeyGeneratorFuncs by function pointer, along with a version of them that counts
+// the bytes read into the provided counter, see progress.counting.
+var countingKeyGenerators = map[uintptr]func(path string, read *atomic.Int64) (string, error){
+	reflect.ValueOf(Crc32HashKeyGenerator).Pointer(): func(path string, read *atomic.Int64) (string, error) {
+		return generateFileHash(path, crc32.NewIEEE(), DefaultHashPrefixSize, read)
+	},
+	reflect.ValueOf(FullCrc32HashKeyGenerator).Pointer(): func(path string, read *atomic.Int64) (string, error) {
+		return generateFileHash(path, crc32.NewIEEE(), -1, read)
+	},
+	reflect.ValueOf(Sha256HashKeyGenerator).Pointer(): func(path string, read *atomic.Int64) (string, error) {
+		return generateFileHash(path, sha256.New(), DefaultHashPrefixSize, read)
+	},
+	reflect.ValueOf(FullSha256HashKeyGenerator).Pointer(): func(path string, read *atomic.Int64) (string, error) {
+		return generateFileHash(path, sha256.New(), -1, read)
+	},
+	reflect.ValueOf(SampledKeyGenerator).Pointer(): func(path string, read *atomic.Int64) (string, error) {
+		return generateSampledHash(path, defaultSampleOptions, read)
+	},
+}
+
+// Hashes the first `size` bytes of the file contents, or the entire file if `size` is negative.
+// The bytes read are added to the provided counter, if any.
+func generateFileHash(path string, hash hash.Hash, size int64, read *atomic.Int64) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -34,11 +107,11 @@ func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
 
 	defer file.Close()
 
-	// Either copy the entire file contents or just the first 16KB.
-	if full {
-		_, err = io.Copy(hash, file)
+	r := countReads(file, read)
+	if size < 0 {
+		_, err = io.Copy(hash, r)
 	} else {
-		_, err = io.CopyN(hash, file, 1024*16)
+		_, err = io.CopyN(hash, r, size)
 	}
 
 	if err != nil && err != io.EOF {
@@ -54,21 +127,108 @@ func generateFileHash(path string, hash hash.Hash, full bool) (string, error) {
 // which should be enough to achieve a good balance of uniqueness, collision
 // resistance, and performance for most files.
 func Crc32HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, crc32.NewIEEE(), false)
+	return generateFileHash(path, crc32.NewIEEE(), DefaultHashPrefixSize, nil)
 }
 
 // Generates a crc32 hash of the entire file contents as the key, which
 // is a lot slower than HashKeyGenerator but should be more accurate.
 func FullCrc32HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, crc32.NewIEEE(), true)
+	return generateFileHash(path, crc32.NewIEEE(), -1, nil)
 }
 
 // Generates a sha256 hash of the first 16KB of the file contents as the key
 func Sha256HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, sha256.New(), false)
+	return generateFileHash(path, sha256.New(), DefaultHashPrefixSize, nil)
 }
 
 // Generates a sha256 hash of the entire file contents as the key
 func FullSha256HashKeyGenerator(path string) (string, error) {
-	return generateFileHash(path, sha256.New(), true)
+	return generateFileHash(path, sha256.New(), -1, nil)
+}
+
+const (
+	DefaultSampleChunkSize = 64 * 1024 // Bytes hashed per sample by the sampled key generators.
+	DefaultSampleMiddle    = 3         // Evenly spaced samples between the start and end of a file.
+)
+
+// Options of a KeyGeneratorFunc created with NewSampledKeyGenerator.
+type SampleOptions struct {
+	NewHash   func() hash.Hash // Hash constructor used for the samples, defaults to sha256.New.
+	ChunkSize int64            // Bytes hashed per sample, defaults to DefaultSampleChunkSize.
+	Middle    int              // Samples between the start and end of the file, defaults to DefaultSampleMiddle, negative for none.
+}
+
+// Creates a KeyGeneratorFunc that combines the file size with a hash of chunks sampled
+// from the start, evenly spaced middle points and the end of the file.
+//
+// Files smaller than all samples combined are hashed entirely. As with NewHashKeyGenerator,
+// Cfg.CacheNamespace must be set when using the generator with a Cache.
+func NewSampledKeyGenerator(opts SampleOptions) KeyGeneratorFunc {
+	if opts.NewHash == nil {
+		opts.NewHash = sha256.New
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultSampleChunkSize
+	}
+	if opts.Middle < 0 {
+		opts.Middle = 0
+	} else if opts.Middle == 0 {
+		opts.Middle = DefaultSampleMiddle
+	}
+
+	return func(path string) (string, error) {
+		return generateSampledHash(path, opts, nil)
+	}
+}
+
+// Options of SampledKeyGenerator.
+var defaultSampleOptions = SampleOptions{
+	NewHash:   sha256.New,
+	ChunkSize: DefaultSampleChunkSize,
+	Middle:    DefaultSampleMiddle,
+}
+
+// Generates a sha256 hash of 64KB chunks at the start, end and three evenly spaced
+// middle points of the file, combined with the file size as the key.
+//
+// Gives close to the accuracy of FullSha256HashKeyGenerator for large files (e.g. videos)
+// at a fraction of the I/O.
+func SampledKeyGenerator(path string) (string, error) {
+	return generateSampledHash(path, defaultSampleOptions, nil)
+}
+
+// The bytes read are added to the provided counter, if any.
+func generateSampledHash(path string, opts SampleOptions, read *atomic.Int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	size := fi.Size()
+	hash := opts.NewHash()
+	samples := int64(opts.Middle) + 2 // start and end
+
+	if size <= samples*opts.ChunkSize {
+		_, err = io.Copy(hash, countReads(file, read))
+	} else {
+		// Offsets are spread evenly from the start to the last chunk of the file.
+		last := size - opts.ChunkSize
+		for i := int64(0); i < samples && err == nil; i++ {
+			offset := last * i / (samples - 1)
+			_, err = io.Copy(hash, countReads(io.NewSectionReader(file, offset, opts.ChunkSize), read))
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d-%s", size, hex.EncodeToString(hash.Sum(nil))), nil
 }
@@ -3,6 +3,7 @@ package dupescout
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +119,96 @@ func TestSha256HashKeyGeneratorInequality(t *testing.T) {
 		t.Errorf("Expected %s to not equal %s", content1, content2)
 	}
 }
+
+func TestNewHashKeyGenerator(t *testing.T) {
+	for name, newHash := range HashFuncs {
+		keygen := NewHashKeyGenerator(newHash, HashOptions{})
+
+		equal, err := hashKeyGeneratorEquality("Hello, World!", keygen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inequal, err := hashKeyGeneratorInequality("Go rocks!", "JavaScript rocks!", keygen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !equal || !inequal {
+			t.Errorf("Expected %s keys to only match for equal contents", name)
+		}
+	}
+}
+
+func TestNewHashKeyGeneratorPrefixSize(t *testing.T) {
+	content1 := "Hello, World!"
+	content2 := "Hello, Gophers!"
+
+	prefix := NewHashKeyGenerator(HashFuncs["sha512"], HashOptions{PrefixSize: 5})
+	equal, err := hashKeyGeneratorEquality(content1, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inequal, err := hashKeyGeneratorInequality(content1, content2, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal || inequal {
+		t.Errorf("Expected %s to equal %s when only hashing the first 5 bytes", content1, content2)
+	}
+
+	full := NewHashKeyGenerator(HashFuncs["sha512"], HashOptions{PrefixSize: 5, Full: true})
+	inequal, err = hashKeyGeneratorInequality(content1, content2, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inequal {
+		t.Errorf("Expected %s to not equal %s when hashing the entire file", content1, content2)
+	}
+}
+
+func TestSampledKeyGenerator(t *testing.T) {
+	chunk := strings.Repeat("a", 1024)
+	keygen := NewSampledKeyGenerator(SampleOptions{ChunkSize: 1024, Middle: 1})
+
+	// Three samples of 1KB at offsets 0, 2KB and 4KB, the gaps in between are never read.
+	sampled := chunk + "bbbb" + chunk[4:] + chunk + chunk + chunk
+	for _, tc := range []struct {
+		name    string
+		content string
+		equal   bool
+	}{
+		{"same samples", chunk + "cccc" + chunk[4:] + chunk + chunk + chunk, true},
+		{"different head", "bbbb" + sampled[4:], false},
+		{"different middle", sampled[:2048] + "bbbb" + sampled[2052:], false},
+		{"different tail", sampled[:len(sampled)-4] + "bbbb", false},
+		{"different size", sampled + "a", false},
+	} {
+		inequal, err := hashKeyGeneratorInequality(sampled, tc.content, keygen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inequal == tc.equal {
+			t.Errorf("%s: expected equal keys to be %t", tc.name, tc.equal)
+		}
+	}
+}
+
+func TestSampledKeyGeneratorSmallFile(t *testing.T) {
+	// Smaller than all samples combined, so the entire file is hashed.
+	content1 := strings.Repeat("a", 1024*64*5)
+	content2 := content1[:1024*64*2] + "b" + content1[1024*64*2+1:]
+
+	inequal, err := hashKeyGeneratorInequality(content1, content2, SampledKeyGenerator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inequal {
+		t.Error("Expected files with a different byte to not share a key")
+	}
+}
@@ -0,0 +1,47 @@
+package dupescout
+
+import "golang.org/x/sync/errgroup"
+
+// A fixed number of goroutines processing the tasks submitted to it.
+//
+// Unlike an errgroup with a limit, submitting only waits for a free spot in the queue
+// and never for a slot held by the submitter itself, so the walkers feeding a pool can't
+// starve it regardless of how both are sized.
+type pool[T any] struct {
+	tasks chan T
+	g     errgroup.Group
+}
+
+// Starts a pool of the provided number of workers, at least one, which run fn for each task.
+func startPool[T any](workers int, fn func(T) error) *pool[T] {
+	workers = max(workers, 1)
+	p := &pool[T]{tasks: make(chan T, workers)}
+
+	for i := 0; i < workers; i++ {
+		p.g.Go(func() error {
+			var first error
+			for task := range p.tasks {
+				// Keep draining after an error, so submitters never block on a dead pool.
+				if err := fn(task); err != nil && first == nil {
+					first = err
+				}
+			}
+			return first
+		})
+	}
+
+	return p
+}
+
+// Queues the provided task, blocking while all workers are busy and the queue is full.
+func (p *pool[T]) submit(task T) {
+	p.tasks <- task
+}
+
+// Waits until all submitted tasks are done and returns the first error, if any.
+//
+// No more tasks can be submitted afterwards.
+func (p *pool[T]) wait() error {
+	close(p.tasks)
+	return p.g.Wait()
+}
@@ -0,0 +1,49 @@
+package dupescout
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPoolKeepsDrainingAfterError(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	var done atomic.Int32
+	p := startPool(1, func(i int) error {
+		done.Add(1)
+		if i == 0 {
+			return errFailed
+		}
+		return nil
+	})
+
+	// Would block forever if the only worker stopped after the first error.
+	for i := 0; i < 10; i++ {
+		p.submit(i)
+	}
+
+	if err := p.wait(); !errors.Is(err, errFailed) {
+		t.Errorf("Expected the error of the first task, got %v", err)
+	}
+
+	if done.Load() != 10 {
+		t.Errorf("Expected all 10 tasks to run, got %d", done.Load())
+	}
+}
+
+func TestPoolAtLeastOneWorker(t *testing.T) {
+	var done atomic.Int32
+	p := startPool(0, func(int) error {
+		done.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		p.submit(i)
+	}
+
+	if err := p.wait(); err != nil || done.Load() != 5 {
+		t.Errorf("Expected all 5 tasks to run without error, got %d and %v", done.Load(), err)
+	}
+}
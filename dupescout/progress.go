@@ -0,0 +1,193 @@
+package dupescout
+
+import (
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// Default interval between calls of the Cfg.Progress hook.
+const defaultProgressInterval = 500 * time.Millisecond
+
+// Stage of a search, see Progress.Stage.
+type Stage int
+
+const (
+	StageWalk    Stage = iota // Files are being found, and their keys generated as they are unless staged.
+	StagePartial              // Files sharing their size are partially hashed, only when staged.
+	StageHash                 // All files have been found and queued, so the queued totals are final.
+)
+
+// Snapshot of the progress of a search, which is passed to the Cfg.Progress hook.
+//
+// The Bytes*** totals add up file sizes, while BytesRead counts the bytes actually read,
+// which is far less when KeyGeneratorFuncs only read a part of each file (e.g. the first 16KB).
+type Progress struct {
+	FilesFound    int64 // Files that passed the filters so far.
+	BytesFound    int64 // Total size of the files found so far.
+	PartialQueued int64 // Files that need their partial hash generated, only when staged.
+	PartialHashed int64 // Files whose partial hash has been generated.
+	FilesQueued   int64 // Files that need their key generated, less than FilesFound when staged.
+	BytesQueued   int64 // Total size of the files that need their key generated.
+	FilesHashed   int64 // Files whose key has been generated.
+	BytesHashed   int64 // Total size of the files whose key has been generated.
+	BytesRead     int64 // Bytes read from the files, counting the whole size of files hashed by custom KeyGeneratorFuncs.
+	Groups        int64 // Groups of duplicates found so far.
+
+	CurrentPath string        // Path of the file whose key was generated most recently.
+	Throughput  float64       // Bytes read per second since the previous snapshot.
+	Elapsed     time.Duration // Time since the search started.
+	Stage       Stage         // Stage of the search, the queued totals are final once it's StageHash.
+	Done        bool          // Whether the search is complete, set for the last snapshot only.
+
+	hashRate float64 // Total size of the files hashed per second, to estimate the remaining time.
+}
+
+// Estimates the remaining time of the search based on the current rate of hashed files.
+//
+// Returns 0 if it can't be estimated yet, which is the case until all files have been
+// found and queued (StageHash).
+func (p Progress) ETA() time.Duration {
+	if p.Stage != StageHash || p.hashRate <= 0 {
+		return 0
+	}
+
+	remaining := float64(p.BytesQueued - p.BytesHashed)
+	return time.Duration(remaining / p.hashRate * float64(time.Second))
+}
+
+// Counters of the progress of a search, updated concurrently by the workers.
+type progress struct {
+	filesFound    atomic.Int64
+	bytesFound    atomic.Int64
+	partialQueued atomic.Int64
+	partialHashed atomic.Int64
+	filesQueued   atomic.Int64
+	bytesQueued   atomic.Int64
+	filesHashed   atomic.Int64
+	bytesHashed   atomic.Int64
+	bytesRead     atomic.Int64
+	groups        atomic.Int64
+	stage         atomic.Int32
+	currentPath   atomic.Pointer[string]
+	start         time.Time
+}
+
+func newProgress() *progress {
+	return &progress{start: time.Now()}
+}
+
+func (p *progress) found(f File) {
+	p.filesFound.Add(1)
+	p.bytesFound.Add(f.Size)
+}
+
+func (p *progress) queued(f File) {
+	p.filesQueued.Add(1)
+	p.bytesQueued.Add(f.Size)
+}
+
+func (p *progress) hashing(f File) {
+	p.currentPath.Store(&f.Path)
+}
+
+func (p *progress) hashed(f File) {
+	p.filesHashed.Add(1)
+	p.bytesHashed.Add(f.Size)
+}
+
+func (p *progress) enter(s Stage) {
+	p.stage.Store(int32(s))
+}
+
+// Returns a function that generates the key of a file with the provided KeyGeneratorFunc,
+// counting the bytes it reads.
+//
+// Only the built-in KeyGeneratorFuncs can be handed the counter (see countingKeyGenerators),
+// others just receive a path, so the size of each file they hash is counted instead.
+func (p *progress) counting(fn KeyGeneratorFunc) func(f File) (string, error) {
+	if counting, ok := countingKeyGenerators[reflect.ValueOf(fn).Pointer()]; ok {
+		return func(f File) (string, error) {
+			return counting(f.Path, &p.bytesRead)
+		}
+	}
+
+	return func(f File) (string, error) {
+		p.bytesRead.Add(f.Size)
+		return fn(f.Path)
+	}
+}
+
+// Reader that adds the bytes read to the counter of a search.
+type countingReader struct {
+	r    io.Reader
+	read *atomic.Int64
+}
+
+// Returns the provided reader counting the bytes read into the provided counter, or the
+// reader itself without a counter.
+func countReads(r io.Reader, read *atomic.Int64) io.Reader {
+	if read == nil {
+		return r
+	}
+	return &countingReader{r, read}
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// Takes a snapshot of the counters, the throughput is computed from the bytes read
+// since the provided previous snapshot.
+func (p *progress) snapshot(prev Progress) Progress {
+	s := Progress{
+		FilesFound:    p.filesFound.Load(),
+		BytesFound:    p.bytesFound.Load(),
+		PartialQueued: p.partialQueued.Load(),
+		PartialHashed: p.partialHashed.Load(),
+		FilesQueued:   p.filesQueued.Load(),
+		BytesQueued:   p.bytesQueued.Load(),
+		FilesHashed:   p.filesHashed.Load(),
+		BytesHashed:   p.bytesHashed.Load(),
+		BytesRead:     p.bytesRead.Load(),
+		Groups:        p.groups.Load(),
+		Elapsed:       time.Since(p.start),
+		Stage:         Stage(p.stage.Load()),
+	}
+
+	if path := p.currentPath.Load(); path != nil {
+		s.CurrentPath = *path
+	}
+
+	if interval := (s.Elapsed - prev.Elapsed).Seconds(); interval > 0 {
+		s.Throughput = float64(s.BytesRead-prev.BytesRead) / interval
+		s.hashRate = float64(s.BytesHashed-prev.BytesHashed) / interval
+	}
+
+	return s
+}
+
+// Calls the provided hook with a snapshot of the progress every interval until the stop
+// channel is closed, after which it's called a last time with Progress.Done set.
+func (p *progress) report(hook func(Progress), interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev Progress
+	for {
+		select {
+		case <-ticker.C:
+			prev = p.snapshot(prev)
+			hook(prev)
+		case <-stop:
+			last := p.snapshot(prev)
+			last.Done = true
+			last.Throughput = float64(last.BytesRead) / last.Elapsed.Seconds() // Average of the whole search.
+			hook(last)
+			return
+		}
+	}
+}
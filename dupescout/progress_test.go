@@ -0,0 +1,91 @@
+package dupescout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressETA(t *testing.T) {
+	p := Progress{BytesQueued: 300, BytesHashed: 100, hashRate: 50}
+
+	if p.ETA() != 0 {
+		t.Errorf("Expected no ETA while files are still being found, got %s", p.ETA())
+	}
+
+	p.Stage = StagePartial
+
+	if p.ETA() != 0 {
+		t.Errorf("Expected no ETA while partial hash collisions are still being queued, got %s", p.ETA())
+	}
+
+	p.Stage = StageHash
+
+	if p.ETA() != 4*time.Second {
+		t.Errorf("Expected ETA of 4s, got %s", p.ETA())
+	}
+
+	p.hashRate = 0
+
+	if p.ETA() != 0 {
+		t.Errorf("Expected no ETA without throughput, got %s", p.ETA())
+	}
+}
+
+func TestProgressSnapshot(t *testing.T) {
+	p := newProgress()
+	f := File{Path: "/a", Size: 100}
+
+	p.found(f)
+	p.queued(f)
+	p.hashing(f)
+	p.hashed(f)
+
+	s := p.snapshot(Progress{})
+	if s.FilesFound != 1 || s.BytesQueued != 100 || s.FilesHashed != 1 || s.BytesHashed != 100 {
+		t.Errorf("Expected counters of a single hashed file, got %+v", s)
+	}
+
+	if s.CurrentPath != "/a" {
+		t.Errorf("Expected current path to be /a, got %s", s.CurrentPath)
+	}
+
+	// Nothing was hashed since the previous snapshot.
+	if next := p.snapshot(s); next.Throughput != 0 {
+		t.Errorf("Expected no throughput, got %f", next.Throughput)
+	}
+}
+
+func TestProgressBytesRead(t *testing.T) {
+	// Larger than the prefix read by Crc32HashKeyGenerator.
+	file, clean := createTempFile(strings.Repeat("a", DefaultHashPrefixSize*4))
+	defer clean()
+
+	f := statFile(t, file.Name())
+
+	p := newProgress()
+	if _, err := p.counting(Crc32HashKeyGenerator)(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if read := p.bytesRead.Load(); read != DefaultHashPrefixSize {
+		t.Errorf("Expected %d bytes read, got %d", DefaultHashPrefixSize, read)
+	}
+
+	// Reads outside of the search are not counted.
+	if _, err := Crc32HashKeyGenerator(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if read := p.bytesRead.Load(); read != DefaultHashPrefixSize {
+		t.Errorf("Expected %d bytes read after hashing outside of the search, got %d", DefaultHashPrefixSize, read)
+	}
+
+	// Custom KeyGeneratorFuncs can't be handed the counter, so the file size is counted instead.
+	custom := func(path string) (string, error) { return Crc32HashKeyGenerator(path) }
+	if _, err := p.counting(custom)(f); err != nil {
+		t.Fatal(err)
+	}
+	if read := p.bytesRead.Load(); read != DefaultHashPrefixSize+f.Size {
+		t.Errorf("Expected %d bytes read with a custom key generator, got %d", DefaultHashPrefixSize+f.Size, read)
+	}
+}
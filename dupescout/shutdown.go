@@ -0,0 +1,30 @@
+package dupescout
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+)
+
+// Returns a copy of the parent context which is cancelled when a SIGINT or SIGTERM
+// is received, so that CLIs can stop the search gracefully after the current workers
+// are done.
+//
+// The signal handler is unregistered once the returned context is done, so make sure
+// to call the returned CancelFunc when the search is complete.
+func ShutdownOnSignal(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, syscall.SIGINT, syscall.SIGTERM)
+
+	// Only a received signal is logged, not the parent being done or the search completing.
+	stopLog := context.AfterFunc(ctx, func() {
+		if parent.Err() == nil {
+			log.Println("\nReceived signal, shutting down after current workers are done...")
+		}
+	})
+
+	return ctx, func() {
+		stopLog()
+		stop()
+	}
+}
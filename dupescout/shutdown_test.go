@@ -0,0 +1,26 @@
+package dupescout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdownOnSignal(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, stop := ShutdownOnSignal(parent)
+	defer stop()
+
+	if ctx.Err() != nil {
+		t.Fatal("Expected context to not be done yet")
+	}
+
+	// Cancelling the parent must also stop the returned context.
+	cancelParent()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("Expected context to be done after cancelling the parent")
+	}
+}
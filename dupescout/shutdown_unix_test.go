@@ -0,0 +1,26 @@
+//go:build unix
+
+package dupescout
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownOnSignalInterrupt(t *testing.T) {
+	ctx, stop := ShutdownOnSignal(context.Background())
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("Expected context to be done after receiving SIGINT")
+	}
+}
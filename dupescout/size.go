@@ -0,0 +1,82 @@
+package dupescout
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Multipliers of the units accepted by ParseSize, which are the ones printed by Size.String.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+	"PIB": 1 << 50,
+	"EIB": 1 << 60,
+}
+
+// Size in bytes which satisfies the flag.Value interface, accepting human readable values
+// such as "100MiB" or "1.5 GiB", see ParseSize.
+//
+// `flag.Var(&cfg.MinSize, "min", "minimum size of the files to search")`
+type Size int64
+
+// Formats the size with a binary unit, e.g. "1.5 GiB".
+func (s Size) String() string {
+	const unit = 1024
+	if s < unit {
+		return fmt.Sprintf("%d B", s)
+	}
+
+	// Calculate the divisor and exponent of the unit symbol to use (KiB, MiB, GiB, etc).
+	div, exp := int64(unit), 0
+	for n := int64(s) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(s)/float64(div), "KMGTPE"[exp])
+}
+
+func (s *Size) Set(val string) error {
+	size, err := ParseSize(val)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+// Parses a size with an optional binary unit (B, KiB, MiB, GiB, TiB, PiB or EiB), which is
+// case insensitive and may be separated by a space. Sizes without a unit are in bytes.
+func ParseSize(val string) (Size, error) {
+	s := strings.TrimSpace(val)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	unit := strings.ToUpper(strings.TrimSpace(s[i:]))
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", val, s[i:])
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", val)
+	}
+
+	size := n * float64(mult)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", val)
+	}
+
+	return Size(size), nil
+}
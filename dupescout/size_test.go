@@ -0,0 +1,55 @@
+package dupescout
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tcs := []struct {
+		val      string
+		expected Size
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512 B", 512},
+		{"100MiB", 100 << 20},
+		{"1.5 GiB", 3 << 29},
+		{"2kib", 2 << 10},
+		{" 1 TiB ", 1 << 40},
+	}
+
+	for _, tc := range tcs {
+		size, err := ParseSize(tc.val)
+		if err != nil || size != tc.expected {
+			t.Errorf("Expected %d for %q, got %d (%v)", tc.expected, tc.val, size, err)
+		}
+	}
+
+	for _, val := range []string{"", "MiB", "100MB", "1.2.3 KiB", "-1", "16EiB"} {
+		if _, err := ParseSize(val); err == nil {
+			t.Errorf("Expected error for %q", val)
+		}
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	tcs := []struct {
+		size     Size
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{100 << 20, "100.0 MiB"},
+		{3 << 29, "1.5 GiB"},
+	}
+
+	for _, tc := range tcs {
+		if s := tc.size.String(); s != tc.expected {
+			t.Errorf("Expected %s for %d, got %s", tc.expected, tc.size, s)
+		}
+
+		// Printed sizes can be parsed back, rounding aside.
+		if size, err := ParseSize(tc.size.String()); err != nil || size != tc.size {
+			t.Errorf("Expected %s to parse back to %d, got %d (%v)", tc.expected, tc.size, size, err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package dupescout
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// Bumped whenever the on-disk format of snapshots changes, older snapshots are discarded.
+const snapshotVersion = 1
+
+// A file recorded in a snapshot.
+type snapshotFile struct {
+	File           // With the key it was grouped by, empty if it was never hashed.
+	Partial string // Partial hash when staged, empty if it was never partially hashed.
+}
+
+// On-disk representation of a snapshot.
+type snapshotData struct {
+	Version   int
+	Namespace string // Namespace of the keys, see Cfg.CacheNamespace.
+	Staged    bool   // Whether the keys of the groups are scoped to the file size.
+	Taken     time.Time
+	Files     map[string]snapshotFile // path -> file
+	Groups    map[string]bool         // keys of the groups of duplicates
+}
+
+// Snapshot records every file found by a search along with its key, so that the next
+// search of the same paths only needs to read new and modified files.
+//
+// Pass it through Cfg.Snapshot: the search reuses the keys of unchanged files from the
+// previous search and marks groups that weren't found by it with Group.New. Once the
+// search completes, the snapshot holds the results of that search instead, which are only
+// persisted when calling Save.
+//
+// Unlike a Cache, a snapshot only holds the files of a single search, so files that were
+// deleted since then are dropped automatically.
+type Snapshot struct {
+	mu   sync.Mutex
+	path string
+	prev snapshotData
+
+	// State of the search in progress.
+	files  *xsync.MapOf[string, snapshotFile]
+	groups *xsync.MapOf[string, struct{}]
+}
+
+// Opens the snapshot stored at the provided path, an empty snapshot is returned if the
+// file doesn't exist yet or was written by an incompatible version.
+func OpenSnapshot(path string) (*Snapshot, error) {
+	path, err := sanitizePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{path: path}
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data snapshotData
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding snapshot %s: %w", s.path, err)
+	}
+
+	if data.Version == snapshotVersion {
+		s.prev = data
+	}
+
+	return s, nil
+}
+
+// Writes the snapshot to its path, replacing the previous file atomically.
+func (s *Snapshot) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.prev
+	data.Version = snapshotVersion
+	return writeGobAtomic(s.path, data)
+}
+
+// Returns when the search recorded in the snapshot started, zero if it's empty.
+func (s *Snapshot) Taken() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prev.Taken
+}
+
+// Returns the number of files recorded in the snapshot.
+func (s *Snapshot) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.prev.Files)
+}
+
+// Starts recording a search with the provided key namespace.
+//
+// Fails if the snapshot was taken with a different KeyGenerator or staging, since its
+// keys can't be compared with the ones of the search.
+func (s *Snapshot) begin(namespace string, staged bool) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.prev.Files != nil && (s.prev.Namespace != namespace || s.prev.Staged != staged) {
+		return fmt.Errorf("snapshot %s was taken with key namespace %q (staged: %t), not %q (staged: %t)",
+			s.path, s.prev.Namespace, s.prev.Staged, namespace, staged)
+	}
+
+	s.prev.Namespace = namespace
+	s.prev.Staged = staged
+	s.files = xsync.NewMapOf[snapshotFile]()
+	s.groups = xsync.NewMapOf[struct{}]()
+	return nil
+}
+
+// Replaces the previous search with the one that was recorded since begin.
+func (s *Snapshot) commit(taken time.Time) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make(map[string]snapshotFile, s.files.Size())
+	s.files.Range(func(path string, sf snapshotFile) bool {
+		files[path] = sf
+		return true
+	})
+
+	groups := make(map[string]bool, s.groups.Size())
+	s.groups.Range(func(key string, _ struct{}) bool {
+		groups[key] = true
+		return true
+	})
+
+	s.prev.Taken = taken
+	s.prev.Files = files
+	s.prev.Groups = groups
+	s.files, s.groups = nil, nil
+}
+
+// Records the provided file as found by the search.
+func (s *Snapshot) found(f File) {
+	if s == nil {
+		return
+	}
+	s.files.Store(f.Path, snapshotFile{File: f})
+}
+
+// Returns the key of the provided file from the previous search if it's unchanged,
+// otherwise generates it with the provided function. Either way the key is recorded.
+func (s *Snapshot) key(f File, generate func() (string, error)) (string, error) {
+	return s.lookup(f, generate, func(sf *snapshotFile) *string { return &sf.Key })
+}
+
+// Like key, but for the partial hash of the staged pipeline.
+func (s *Snapshot) partial(f File, generate func() (string, error)) (string, error) {
+	return s.lookup(f, generate, func(sf *snapshotFile) *string { return &sf.Partial })
+}
+
+func (s *Snapshot) lookup(f File, generate func() (string, error), field func(*snapshotFile) *string) (string, error) {
+	if s == nil {
+		return generate()
+	}
+
+	if prev, ok := s.prev.Files[f.Path]; ok && prev.unchanged(f) && *field(&prev) != "" {
+		s.record(f, *field(&prev), field)
+		return *field(&prev), nil
+	}
+
+	key, err := generate()
+	if err == nil && key != "" {
+		s.record(f, key, field)
+	}
+	return key, err
+}
+
+func (s *Snapshot) record(f File, key string, field func(*snapshotFile) *string) {
+	s.files.Compute(f.Path, func(sf snapshotFile, loaded bool) (snapshotFile, bool) {
+		if !loaded {
+			sf.File = f
+		}
+		*field(&sf) = key
+		return sf, false
+	})
+}
+
+// Records the group with the provided key and reports whether the previous search
+// found no group with that key.
+func (s *Snapshot) newGroup(key string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.groups.Store(key, struct{}{})
+	return s.prev.Files != nil && !s.prev.Groups[key]
+}
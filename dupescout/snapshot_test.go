@@ -0,0 +1,109 @@
+package dupescout
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSnapshotRescan(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Hello, World!",
+		"c.txt": "Go rocks!",
+		"d.txt": "Go rules!",
+	})
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	var calls atomic.Int32
+	keygen := func(path string) (string, error) {
+		calls.Add(1)
+		return FullCrc32HashKeyGenerator(path)
+	}
+
+	// Searches the tree with the snapshot stored at path and saves the results to it.
+	search := func() []Group {
+		t.Helper()
+		snapshot, err := OpenSnapshot(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		groups, err := GetGroups(Cfg{Paths: []string{dir}, KeyGenerator: keygen, Snapshot: snapshot, CacheNamespace: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := snapshot.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return groups
+	}
+
+	groups := search()
+	if len(groups) != 1 || groups[0].New {
+		t.Fatalf("Expected a single group that isn't new without a previous search, got %+v", groups)
+	}
+
+	// c.txt is modified to match e.txt, which is new, while b.txt is deleted.
+	if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte("Gophers rock!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "e.txt"), []byte("Gophers rock!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte("Hello, World!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	calls.Store(0)
+	groups = search()
+
+	// Only the modified and new files are read again.
+	if calls.Load() != 3 {
+		t.Errorf("Expected key generator to be called 3 times, got %d", calls.Load())
+	}
+
+	news := map[bool][]string{}
+	for _, g := range groups {
+		news[g.New] = append(news[g.New], baseNames(g.Files)...)
+	}
+
+	want := map[bool][]string{false: {"a.txt", "f.txt"}, true: {"c.txt", "e.txt"}}
+	if !reflect.DeepEqual(news, want) {
+		t.Errorf("Expected %v, got %v", want, news)
+	}
+
+	snapshot, err := OpenSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.Len() != 5 || snapshot.Taken().IsZero() {
+		t.Errorf("Expected 5 files in the snapshot, got %d taken at %s", snapshot.Len(), snapshot.Taken())
+	}
+}
+
+func TestSnapshotNamespaceMismatch(t *testing.T) {
+	dir := createTempTree(t, map[string]string{"a.txt": "Hello, World!"})
+
+	snapshot, err := OpenSnapshot(filepath.Join(t.TempDir(), "snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetGroups(Cfg{Paths: []string{dir}, Snapshot: snapshot}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys of different generators can't be compared.
+	_, err = GetGroups(Cfg{Paths: []string{dir}, Snapshot: snapshot, KeyGenerator: Sha256HashKeyGenerator})
+	if err == nil {
+		t.Error("Expected an error for a snapshot of another key generator")
+	}
+}
@@ -0,0 +1,279 @@
+package dupescout
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	spillEntryOverhead = 128 // Approximate bytes of an indexed file besides its strings.
+	maxMergeRuns       = 64  // Runs merged at once, to bound the number of open files.
+)
+
+// Encoding of a pair in a run, since gob only encodes exported fields.
+type spillEntry struct {
+	Key  string
+	File File
+}
+
+// Indexes files by key within a memory limit, see Cfg.MemoryLimit.
+//
+// Files are buffered in memory until the limit is reached, at which point the buffer
+// is sorted by key and written to a temporary file (a run). Once all files are added,
+// the runs are merged so that the files of each key are read back together.
+type spillIndex struct {
+	mu    sync.Mutex
+	limit int64
+	dir   string // where the runs are created
+	buf   []pair
+	size  int64    // approximate bytes of the buffered files
+	runs  []string // paths of the spilled runs
+	err   error    // first error while spilling, which stops further indexing
+}
+
+func newSpillIndex(limit int64, dir string) *spillIndex {
+	return &spillIndex{limit: limit, dir: dir}
+}
+
+// Adds the provided file, spilling the buffer once it reaches the memory limit.
+//
+// Once spilling failed, no more files are buffered and the error is returned instead, so
+// that memory stays bounded and the search can be stopped right away.
+func (x *spillIndex) add(key string, f File) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.err != nil {
+		return x.err
+	}
+
+	x.buf = append(x.buf, pair{key: key, file: f})
+	x.size += int64(len(key)+len(f.Path)+len(f.Key)) + spillEntryOverhead
+
+	if x.size >= x.limit {
+		x.err = x.spill()
+	}
+	return x.err
+}
+
+// Writes the sorted buffer to a new run.
+func (x *spillIndex) spill() error {
+	sortPairs(x.buf)
+	path, err := writeRun(x.dir, func(enc *gob.Encoder) error {
+		for _, p := range x.buf {
+			if err := enc.Encode(spillEntry{p.key, p.file}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	x.runs = append(x.runs, path)
+	x.buf = nil
+	x.size = 0
+	return nil
+}
+
+func (x *spillIndex) collisions(fn func(key string, files []File) error) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// Files indexed before a failed spill are still grouped, like those of a cancelled
+	// search, since the error was already returned by add.
+
+	// Merge the oldest runs until few enough are left to merge them all at once.
+	for len(x.runs) > maxMergeRuns {
+		path, err := writeRun(x.dir, func(enc *gob.Encoder) error {
+			return mergeRuns(x.runs[:maxMergeRuns], nil, func(p *pair) error {
+				return enc.Encode(spillEntry{p.key, p.file})
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, run := range x.runs[:maxMergeRuns] {
+			os.Remove(run)
+		}
+		x.runs = append([]string{path}, x.runs[maxMergeRuns:]...) // Still the oldest files.
+	}
+
+	sortPairs(x.buf)
+
+	var key string
+	var files []File
+	flush := func() error {
+		if len(files) < 2 {
+			return nil
+		}
+		return fn(key, files)
+	}
+
+	err := mergeRuns(x.runs, x.buf, func(p *pair) error {
+		if len(files) > 0 && p.key != key {
+			if err := flush(); err != nil {
+				return err
+			}
+			files = nil // Handed over to fn, which may keep it.
+		}
+
+		key = p.key
+		files = append(files, p.file)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// Removes all runs and drops the buffered files.
+func (x *spillIndex) close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var errs []error
+	for _, run := range x.runs {
+		if err := os.Remove(run); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	x.runs = nil
+	x.buf = nil
+	return errors.Join(errs...)
+}
+
+// Helper to sort pairs by key, keeping the order in which files were found within a key.
+func sortPairs(pairs []pair) {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+}
+
+// Creates a run in the provided directory and writes its pairs with the provided function.
+func writeRun(dir string, write func(*gob.Encoder) error) (string, error) {
+	file, err := os.CreateTemp(dir, "dupescout-run-*")
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(file)
+	err = write(gob.NewEncoder(w))
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// A sorted source of pairs being merged, either a run or the in-memory buffer.
+type runReader struct {
+	next func() (*pair, error) // returns io.EOF once exhausted
+	head *pair
+	seq  int // order of the source, to keep pairs of the same key in the order they were spilled
+}
+
+// Min-heap of run readers by the key of their head.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].head.key != h[j].head.key {
+		return h[i].head.key < h[j].head.key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(r any)   { *h = append(*h, r.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// Calls fn with the pairs of the provided runs and sorted buffer in key order.
+func mergeRuns(runs []string, buf []pair, fn func(*pair) error) error {
+	h := runHeap{}
+
+	for i, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		dec := gob.NewDecoder(bufio.NewReader(file))
+		h = append(h, &runReader{seq: i, next: func() (*pair, error) {
+			var e spillEntry
+			if err := dec.Decode(&e); err != nil {
+				return nil, err
+			}
+			return &pair{key: e.Key, file: e.File}, nil
+		}})
+	}
+
+	h = append(h, &runReader{seq: len(runs), next: func() (*pair, error) {
+		if len(buf) == 0 {
+			return nil, io.EOF
+		}
+		p := &buf[0]
+		buf = buf[1:]
+		return p, nil
+	}})
+
+	// Drop the sources that are empty from the start.
+	readers := h[:0]
+	for _, r := range h {
+		p, err := r.next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.head = p
+		readers = append(readers, r)
+	}
+	h = readers
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		r := h[0]
+		if err := fn(r.head); err != nil {
+			return err
+		}
+
+		p, err := r.next()
+		switch {
+		case err == io.EOF:
+			heap.Pop(&h)
+		case err != nil:
+			return err
+		default:
+			r.head = p
+			heap.Fix(&h, 0)
+		}
+	}
+
+	return nil
+}
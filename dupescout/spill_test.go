@@ -0,0 +1,99 @@
+package dupescout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSpillIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	// Every file is spilled to its own run, so the runs need to be merged in multiple passes.
+	x := newSpillIndex(1, dir)
+	want := map[string][]string{}
+	for i := 0; i < 3*maxMergeRuns; i++ {
+		key := fmt.Sprintf("key-%d", i%50)
+		path := fmt.Sprintf("/file-%d", i)
+		x.add(key, File{Path: path, Size: int64(i)})
+
+		want[key] = append(want[key], path)
+	}
+
+	if len(x.runs) != 3*maxMergeRuns {
+		t.Fatalf("Expected %d runs, got %d", 3*maxMergeRuns, len(x.runs))
+	}
+
+	got := map[string][]string{}
+	var keys []string
+	err := x.collisions(func(key string, files []File) error {
+		keys = append(keys, key)
+		got[key] = filePaths(files)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files of a key are read back in the order they were added.
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("Expected keys in sorted order, got %v", keys)
+		}
+	}
+
+	if err := x.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected all runs to be removed, got %d files", len(entries))
+	}
+}
+
+func TestSpillIndexSkipsUniqueKeys(t *testing.T) {
+	x := newSpillIndex(200, t.TempDir())
+	defer x.close()
+
+	x.add("a", File{Path: "/a1"})
+	x.add("b", File{Path: "/b1"})
+	x.add("a", File{Path: "/a2"})
+	x.add("c", File{Path: "/c1"})
+
+	var keys []string
+	x.collisions(func(key string, files []File) error {
+		keys = append(keys, key)
+		return nil
+	})
+
+	if !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("Expected only key a to collide, got %v", keys)
+	}
+}
+
+func TestSpillIndexFailedSpill(t *testing.T) {
+	x := newSpillIndex(200, filepath.Join(t.TempDir(), "missing"))
+	defer x.close()
+
+	var err error
+	for i := 0; err == nil && i < 10; i++ {
+		err = x.add("a", File{Path: fmt.Sprintf("/a%d", i)})
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected the spill to fail, got %v", err)
+	}
+
+	// No more files are buffered once spilling failed.
+	buffered := len(x.buf)
+	if err := x.add("a", File{Path: "/b"}); err == nil || len(x.buf) != buffered {
+		t.Errorf("Expected the failed spill to be returned without buffering, got %v and %d files", err, len(x.buf))
+	}
+}
@@ -0,0 +1,124 @@
+package dupescout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// Groups files by key, either in memory or spilled to disk when Cfg.MemoryLimit is set.
+type fileIndex interface {
+	// Adds the provided file, failing if it can't be indexed within the memory limit.
+	add(key string, f File) error
+
+	// Calls fn with the files of each key that holds more than one file, once all files are added.
+	collisions(fn func(key string, files []File) error) error
+
+	// Releases the resources of the index, which can't be used afterwards.
+	close() error
+}
+
+// Creates an in-memory index, or one that spills to disk past the provided memory limit.
+func newFileIndex(limit int64, spillDir string) fileIndex {
+	if limit > 0 {
+		return newSpillIndex(limit, spillDir)
+	}
+	return newBuckets()
+}
+
+// Groups files that share a key (size, partial hash) in memory so that only collisions
+// are passed to the next stage of the pipeline.
+type buckets struct {
+	m *xsync.MapOf[string, []File]
+}
+
+func newBuckets() *buckets {
+	return &buckets{m: xsync.NewMapOf[[]File]()}
+}
+
+func (b *buckets) add(key string, f File) error {
+	b.m.Compute(key, func(files []File, _ bool) ([]File, bool) {
+		return append(files, f), false
+	})
+	return nil
+}
+
+func (b *buckets) collisions(fn func(key string, files []File) error) error {
+	var err error
+	b.m.Range(func(key string, bucket []File) bool {
+		if len(bucket) > 1 {
+			err = fn(key, bucket)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (b *buckets) close() error {
+	b.m.Clear()
+	return nil
+}
+
+// Namespace used to cache the partial hashes of the staged pipeline.
+var partialCacheNamespace = funcName(Crc32HashKeyGenerator)
+
+// Helper to scope a key to a file size, so that files of different sizes never
+// end up in the same group even if the KeyGeneratorFunc only looks at a part of the file.
+func sizedKey(size int64, key string) string {
+	return fmt.Sprintf("%d-%s", size, key)
+}
+
+// Runs the partial hash and key generation stages on the files collected by the walker
+// when `Cfg.Staged` is enabled.
+//
+// 1. Only files which share their size with another file are partially hashed.
+// 2. Only files which share their partial hash are passed to the hashers, which generate
+// their key with `dup.generatorFn`.
+func (dup *dupescout) runStages() error {
+	partials := dup.newIndex()
+	defer partials.close()
+	dup.progress.enter(StagePartial)
+
+	partial := newDevicePools(dup.workers, dup.deviceWorkers, dup.rotational, func(f File) error {
+		if dup.shuttingDown() {
+			return nil
+		}
+		defer dup.progress.partialHashed.Add(1)
+
+		// Partial hashes are cached like any other key generated by Crc32HashKeyGenerator.
+		key, err := dup.snapshot.partial(f, func() (string, error) {
+			return dup.cache.key(partialCacheNamespace, f, dup.partialFn)
+		})
+		if err != nil {
+			return dup.errs.recover(f.Path, OpKey, err)
+		}
+
+		dup.index(partials, sizedKey(f.Size, key), f)
+		return nil
+	})
+
+	err := dup.sizes.collisions(func(_ string, files []File) error {
+		for _, f := range files {
+			dup.progress.partialQueued.Add(1)
+			partial.submit(f)
+		}
+		return nil
+	})
+	err = errors.Join(err, partial.wait(), dup.sizes.close())
+	if err != nil {
+		return err
+	}
+
+	err = partials.collisions(func(_ string, files []File) error {
+		for _, f := range files {
+			dup.progress.queued(f)
+			dup.hashers.submit(f)
+		}
+		return nil
+	})
+
+	// Only final once every partial hash collision is queued.
+	dup.progress.enter(StageHash)
+	return err
+}
@@ -0,0 +1,170 @@
+package dupescout
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// Keeps track of visited directories and symlinked files when following symlinks.
+type symlinks struct {
+	dirs  *xsync.MapOf[string, struct{}] // "dev:ino" of every visited directory
+	files *xsync.MapOf[string, []File]   // resolved target path -> target and symlinks pointing to it
+}
+
+func newSymlinks() *symlinks {
+	return &symlinks{
+		dirs:  xsync.NewMapOf[struct{}](),
+		files: xsync.NewMapOf[[]File](),
+	}
+}
+
+// Records the provided directory and reports whether it was already visited, either
+// through another symlink or because the symlink points to one of its ancestors (loop).
+func (s *symlinks) visited(fi fs.FileInfo) bool {
+	key := dirKey(fi)
+	if key == "" {
+		return false // Loops can't be detected without inode numbers.
+	}
+
+	_, loaded := s.dirs.LoadOrStore(key, struct{}{})
+	return loaded
+}
+
+// Forgets the directory of the provided key (see dirKey), so that it's walked again once
+// it's visited next, e.g. after being moved.
+func (s *symlinks) forget(key string) {
+	s.dirs.Delete(key)
+}
+
+// Returns the "dev:ino" key of the provided directory, or an empty string without inode numbers.
+func dirKey(fi fs.FileInfo) string {
+	dev, ino := fileID(fi)
+	if ino == 0 {
+		return ""
+	}
+	return inodeKey(File{Dev: dev, Inode: ino})
+}
+
+// Records the provided symlink as an alias of the file at the resolved target path.
+func (s *symlinks) add(target string, link File) {
+	s.files.Compute(target, func(files []File, loaded bool) ([]File, bool) {
+		if !loaded {
+			// The symlink was followed, so its file info is the one of the target.
+			f := link
+			f.Path = target
+			files = append(files, f)
+		}
+		return append(files, link), false
+	})
+}
+
+// Returns the targets and symlinks pointing to them, grouped by the resolved target path.
+func (s *symlinks) groups() map[string][]File {
+	groups := map[string][]File{}
+	s.files.Range(func(target string, files []File) bool {
+		groups[target] = files
+		return true
+	})
+	return groups
+}
+
+// Reports whether the resolved target path is located inside one of the provided roots,
+// meaning the target itself is part of the search.
+func insideRoots(target string, roots []string) bool {
+	_, ok := rootOf(target, roots)
+	return ok
+}
+
+// Returns the first of the provided roots the resolved target path is located inside of.
+func rootOf(target string, roots []string) (string, bool) {
+	for _, root := range roots {
+		// Roots may end with a separator, e.g. "/".
+		if target == root || strings.HasPrefix(target, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+// Helper to resolve the symlinks of the provided paths, paths that can't be resolved are kept as is.
+func resolvePaths(paths []string) []string {
+	resolved := make([]string, len(paths))
+	for i, path := range paths {
+		resolved[i] = path
+		if r, err := filepath.EvalSymlinks(path); err == nil {
+			resolved[i] = r
+		}
+	}
+	return resolved
+}
+
+// Reports whether the resolved target inside the provided root is found by the walker on its
+// own, meaning neither the file nor any of its directories below the root is filtered out.
+func (dup *dupescout) walksTarget(target, root string) bool {
+	if dup.filters.skipFile(target, root) {
+		return false
+	}
+
+	for dir := filepath.Dir(target); dir != root && insideRoots(dir, []string{root}); dir = filepath.Dir(dir) {
+		if dup.filters.skipDir(dir, root) {
+			return false
+		}
+	}
+	return true
+}
+
+// Follows the symlink of the provided entry, walking it if it points to a directory
+// or handling the target as a regular file otherwise.
+func (dup *dupescout) followSymlink(t dirTask) error {
+	path, rootDev := t.path, t.root.dev
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil // Broken symlink.
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil
+	}
+
+	if fi.IsDir() {
+		if dup.filters.skipDir(path, t.root.path) || !dup.enterDir(target, fi, rootDev) {
+			return nil
+		}
+
+		// Read from the resolved target, but reported under the path of the symlink.
+		dup.walker.walk(dirTask{target, path, t.root})
+		return nil
+	}
+
+	if dup.skipFilesystem(target, fi, rootDev) {
+		return nil
+	}
+
+	if !fi.Mode().IsRegular() || dup.filters.skipFile(path, t.root.path) || dup.filters.skipSize(fi.Size()) {
+		return nil
+	}
+
+	f := newFile(path, fi)
+	f.Root = t.root.path
+	f.Reference = t.root.reference
+	if root, ok := rootOf(target, dup.roots); ok && dup.walksTarget(target, root) {
+		// The target is found by the search on its own, so the symlink is not a copy of it.
+		if dup.reportSymlinks {
+			dup.symlinks.add(target, f)
+		}
+		return nil
+	}
+
+	// Multiple symlinks may point to the same file outside of the search.
+	if f.Inode != 0 && dup.links.seen(f) {
+		return nil
+	}
+
+	dup.addFile(f)
+	return nil
+}
@@ -0,0 +1,132 @@
+package dupescout
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInsideRoots(t *testing.T) {
+	roots := []string{"/mnt/media", "/home/user/Downloads"}
+
+	tcs := []struct {
+		target   string
+		expected bool
+	}{
+		{"/mnt/media/movie.mkv", true},
+		{"/mnt/media", true},
+		{"/home/user/Downloads/sub/movie.mkv", true},
+		{"/mnt/media2/movie.mkv", false},
+		{"/home/user/movie.mkv", false},
+	}
+
+	for _, tc := range tcs {
+		if inside := insideRoots(tc.target, roots); inside != tc.expected {
+			t.Errorf("Expected %t for %s, got %t", tc.expected, tc.target, inside)
+		}
+	}
+
+	if !insideRoots("/mnt/media/movie.mkv", []string{"/"}) {
+		t.Error("Expected everything to be inside the root directory")
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"media/a.txt": "Hello, World!",
+		"media/b.txt": "Go rocks!",
+		"other/c.txt": "Go rocks!",
+		"other/d.txt": "Outside",
+	})
+	media := filepath.Join(dir, "media")
+
+	links := map[string]string{
+		filepath.Join(media, "loop"):       media,                                // Loop back to the root.
+		filepath.Join(media, "other"):      filepath.Join(dir, "other"),          // Directory outside the root.
+		filepath.Join(media, "link-a.txt"): filepath.Join(media, "a.txt"),        // File inside the search.
+		filepath.Join(media, "link-d.txt"): filepath.Join(dir, "other", "d.txt"), // File outside the search.
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	dupes, err := GetResults(Cfg{Paths: []string{media}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dupes) != 0 {
+		t.Errorf("Expected no duplicates without following symlinks, got %v", dupes)
+	}
+
+	cfg := Cfg{Paths: []string{media}, ReportSymlinks: true}
+	cfg.FollowSymlinks = true
+
+	groups, err := GetGroups(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %+v", groups)
+	}
+
+	// Found through the symlinked directory, link-d.txt and d.txt are the same file.
+	if names := baseNames(groups[0].Files); groups[0].Symlinked || !reflect.DeepEqual(names, []string{"b.txt", "c.txt"}) {
+		t.Errorf("Expected duplicates [b.txt c.txt], got %v", names)
+	}
+
+	if names := baseNames(groups[1].Files); !groups[1].Symlinked || !reflect.DeepEqual(names, []string{"a.txt", "link-a.txt"}) {
+		t.Errorf("Expected symlinked group [a.txt link-a.txt], got %v", names)
+	}
+
+	// Paths found through a symlinked directory are reported under the symlink.
+	for _, path := range groups[0].Paths() {
+		if filepath.Base(path) == "c.txt" && path != filepath.Join(media, "other", "c.txt") {
+			t.Errorf("Expected c.txt to be reported under the symlink, got %s", path)
+		}
+	}
+}
+
+func TestFollowSymlinksFilteredTarget(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		".stash/a.mkv": "Hello, World!",
+		"extras/b.mkv": "Go rocks!",
+		"movies/a.mkv": "Hello, World!",
+		"movies/b.mkv": "Go rocks!",
+		"movies/c.mkv": "Outside",
+	})
+
+	links := map[string]string{
+		filepath.Join(dir, "movies", "link-a.mkv"): filepath.Join(dir, ".stash", "a.mkv"), // Target in a hidden directory.
+		filepath.Join(dir, "movies", "link-b.mkv"): filepath.Join(dir, "extras", "b.mkv"), // Target in an excluded directory.
+		filepath.Join(dir, "movies", "link-c.mkv"): filepath.Join(dir, "movies", "c.mkv"), // Target found by the walker.
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	cfg := Cfg{Paths: []string{dir}}
+	cfg.FollowSymlinks = true
+	cfg.DirsExclude = []string{"extras"}
+
+	groups, err := GetGroups(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Targets the walker never reaches are only found through their symlinks.
+	var names [][]string
+	for _, g := range groups {
+		names = append(names, baseNames(g.Files))
+	}
+	expected := [][]string{{"a.mkv", "link-a.mkv"}, {"b.mkv", "link-b.mkv"}}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,176 @@
+package dupescout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// Size of the chunks that are read from each file when comparing contents.
+const verifyChunkSize = 64 * 1024
+
+// Error of one of the files compared by sameContents, telling which of them failed.
+type compareError struct {
+	path string
+	err  error
+}
+
+func (e *compareError) Error() string {
+	return e.err.Error()
+}
+
+func (e *compareError) Unwrap() error {
+	return e.err
+}
+
+// Compares the contents of the two provided files byte by byte, failing with a
+// *compareError of the file that couldn't be read. The bytes read are added to the
+// provided counter, if any.
+//
+// Both files are read in chunks of `verifyChunkSize`, so memory usage stays the same
+// regardless of the file sizes.
+func sameContents(path1, path2 string, read *atomic.Int64) (bool, error) {
+	f1, err := os.Open(path1)
+	if err != nil {
+		return false, &compareError{path1, err}
+	}
+	defer f1.Close()
+
+	f2, err := os.Open(path2)
+	if err != nil {
+		return false, &compareError{path2, err}
+	}
+	defer f2.Close()
+
+	fi1, err := f1.Stat()
+	if err != nil {
+		return false, &compareError{path1, err}
+	}
+
+	fi2, err := f2.Stat()
+	if err != nil {
+		return false, &compareError{path2, err}
+	}
+
+	if fi1.Size() != fi2.Size() {
+		return false, nil
+	}
+
+	r1, r2 := countReads(f1, read), countReads(f2, read)
+	buf1 := make([]byte, verifyChunkSize)
+	buf2 := make([]byte, verifyChunkSize)
+
+	for {
+		n1, err1 := io.ReadFull(r1, buf1)
+		n2, err2 := io.ReadFull(r2, buf2)
+
+		// A failed read says nothing about the contents, so it's reported before comparing.
+		eof1 := err1 == io.EOF || err1 == io.ErrUnexpectedEOF
+		eof2 := err2 == io.EOF || err2 == io.ErrUnexpectedEOF
+		if err1 != nil && !eof1 {
+			return false, &compareError{path1, err1}
+		}
+
+		if err2 != nil && !eof2 {
+			return false, &compareError{path2, err2}
+		}
+
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+
+		// Either both files ended at the same spot or only one of them did.
+		if eof1 && eof2 {
+			return true, nil
+		}
+
+		if eof1 || eof2 {
+			return false, nil // Files changed in size since the stat.
+		}
+	}
+}
+
+// Tells apart files with the same key but different contents, by assigning each file to a
+// variant of its key whose files are identical.
+//
+// Each file is compared with the first file of every variant of its key. Files of different
+// keys are compared concurrently by the hashers, while files of the same key wait for each
+// other, so that the pair consumer never reads a file itself.
+type verifier struct {
+	keys     *xsync.MapOf[string, *variants]
+	progress *progress   // counts the bytes read by the comparisons
+	errs     *scanErrors // errors of the first files of variants that can no longer be read
+}
+
+// Paths of the first file of each variant of a key, empty once a variant has no files left.
+type variants struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func newVerifier(p *progress, errs *scanErrors) *verifier {
+	return &verifier{keys: xsync.NewMapOf[*variants](), progress: p, errs: errs}
+}
+
+// Returns the variant of the provided file among the files of its key so far, comparing it
+// byte by byte with the first file of each variant.
+//
+// Fails only if the provided file can't be read. A variant whose first file can't be read
+// is dropped instead, and its error is recorded.
+func (v *verifier) assign(key string, f File) (int, error) {
+	vs, _ := v.keys.LoadOrCompute(key, func() *variants { return &variants{} })
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for i, path := range vs.paths {
+		if path == "" {
+			continue // No files left to compare with.
+		}
+
+		same, err := sameContents(path, f.Path, &v.progress.bytesRead)
+		if err != nil {
+			var ce *compareError
+			if !errors.As(err, &ce) || ce.path != path {
+				return 0, err
+			}
+
+			// Nothing can be compared with the variant anymore, its files stay in their group.
+			v.errs.add(path, OpVerify, ce.err)
+			vs.paths[i] = ""
+			continue
+		}
+
+		if same {
+			return i, nil
+		}
+	}
+
+	vs.paths = append(vs.paths, f.Path)
+	return len(vs.paths) - 1, nil
+}
+
+// Replaces the file that the provided variant is compared with, once the previous one is
+// removed from its group. An empty path drops the variant.
+//
+// A nil verifier does nothing.
+func (v *verifier) replace(key string, variant int, path string) {
+	if v == nil {
+		return
+	}
+
+	vs, ok := v.keys.Load(key)
+	if !ok {
+		return
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if variant < len(vs.paths) {
+		vs.paths[variant] = path
+	}
+}
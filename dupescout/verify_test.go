@@ -0,0 +1,104 @@
+package dupescout
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSameContents(t *testing.T) {
+	// Spans multiple chunks, with the only difference being in the last one.
+	content := strings.Repeat("a", verifyChunkSize*2+10)
+	tcs := []struct {
+		content1 string
+		content2 string
+		expected bool
+	}{
+		{"Hello, World!", "Hello, World!", true},
+		{"Go rocks!", "Go rules!", false},
+		{"Go rocks!", "Go rocks!!", false},
+		{content, content, true},
+		{content + "b", content + "c", false},
+		{"", "", true},
+	}
+
+	for _, tc := range tcs {
+		file1, clean := createTempFile(tc.content1)
+		defer clean()
+
+		file2, clean := createTempFile(tc.content2)
+		defer clean()
+
+		same, err := sameContents(file1.Name(), file2.Name(), nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if same != tc.expected {
+			t.Errorf("Expected %t for contents of length %d and %d, got %t", tc.expected, len(tc.content1), len(tc.content2), same)
+		}
+	}
+}
+
+func TestSameContentsReadError(t *testing.T) {
+	// Reading a directory fails, even though opening and stating it succeeds.
+	dir := t.TempDir()
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() == 0 {
+		t.Skip("Directory has no size to match")
+	}
+
+	file, clean := createTempFile(strings.Repeat("a", int(fi.Size())))
+	defer clean()
+
+	if same, err := sameContents(file.Name(), dir, nil); err == nil {
+		t.Errorf("Expected read error, got %t", same)
+	}
+}
+
+func TestVerifierAssign(t *testing.T) {
+	paths := map[string]string{}
+	for name, content := range map[string]string{"a": "Hello, World!", "b": "Go rocks!", "c": "Hello, World!"} {
+		file, clean := createTempFile(content)
+		defer clean()
+		paths[name] = file.Name()
+	}
+
+	errs := &scanErrors{}
+	v := newVerifier(newProgress(), errs)
+	assign := func(name string) int {
+		t.Helper()
+		variant, err := v.assign("key", File{Path: paths[name]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return variant
+	}
+
+	if a, b, c := assign("a"), assign("b"), assign("c"); a != 0 || b != 1 || c != 0 {
+		t.Errorf("Expected variants 0, 1 and 0, got %d, %d and %d", a, b, c)
+	}
+
+	// Files of a dropped variant are no longer compared with.
+	v.replace("key", 0, "")
+	if c := assign("c"); c != 2 {
+		t.Errorf("Expected new variant 2 once variant 0 is dropped, got %d", c)
+	}
+
+	// A variant whose file can't be read anymore is dropped, without failing the compared file.
+	if err := os.Remove(paths["b"]); err != nil {
+		t.Fatal(err)
+	}
+	if c := assign("c"); c != 2 {
+		t.Errorf("Expected variant 2 once variant 1 can't be read, got %d", c)
+	}
+	if len(errs.errs) != 1 || errs.errs[0].Path != paths["b"] || errs.errs[0].Op != OpVerify {
+		t.Errorf("Expected a verify error for %s, got %v", paths["b"], errs.errs)
+	}
+	if _, err := v.assign("key", File{Path: paths["b"]}); err == nil {
+		t.Error("Expected an error for a file that can't be read")
+	}
+}
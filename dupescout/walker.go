@@ -0,0 +1,244 @@
+package dupescout
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultWalkers = 8   // Default number of directories read concurrently.
+	readDirBatch   = 512 // Entries read from a directory at once.
+)
+
+// A path to search in, which all directories walked from it share.
+type searchRoot struct {
+	path      string // entry of Cfg.Paths or Cfg.References
+	dev       uint64 // device of the path, which symlinked directories inherit
+	reference bool   // whether the path is one of Cfg.References
+}
+
+// A directory to be read by the walker.
+type dirTask struct {
+	dir  string // path the directory is read from
+	path string // path the directory is reported as, differs from dir inside symlinked directories
+	root *searchRoot
+}
+
+// Reports whether the directory was reached through a symlinked directory, in which case
+// its files may also be found through other symlinks.
+func (t dirTask) linked() bool {
+	return t.dir != t.path
+}
+
+// Returns the task of the provided entry of the directory.
+func (t dirTask) child(name string) dirTask {
+	return dirTask{filepath.Join(t.dir, name), filepath.Join(t.path, name), t.root}
+}
+
+// Reads directories concurrently with a fixed number of goroutines.
+//
+// Subdirectories are handed over to an idle goroutine if there is one, otherwise they are
+// walked depth-first by the goroutine that found them. Pending directories are therefore
+// never queued, which keeps memory bounded by the depth of the tree rather than its width.
+type walker struct {
+	dup     *dupescout
+	dirs    chan dirTask   // unbuffered, so a send only succeeds if a goroutine is idle
+	pending sync.WaitGroup // directories that are handed over or being walked
+	failed  atomic.Bool    // set once a walk failed, which stops all others
+	errOnce sync.Once
+	err     error
+}
+
+// Starts a walker with the provided number of goroutines, at least one.
+func (dup *dupescout) startWalker(workers int) *walker {
+	w := &walker{dup: dup, dirs: make(chan dirTask)}
+
+	for i := 0; i < max(workers, 1); i++ {
+		go func() {
+			for t := range w.dirs {
+				w.walkDir(t)
+				w.pending.Done()
+			}
+		}()
+	}
+
+	return w
+}
+
+// Walks the tree of the provided path to search in, blocking until a goroutine takes it.
+// Its files are marked as references if it's one of Cfg.References.
+//
+// Unlike its subdirectories, the path itself is never skipped by the dir filters.
+func (w *walker) walkRoot(path string, reference bool) {
+	dup := w.dup
+	t := dirTask{path, path, &searchRoot{path, pathDev(path), reference}}
+
+	if dup.filters.FollowSymlinks || dup.filters.filtersFilesystems() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			w.fail(dup.errs.recover(path, OpWalk, err))
+			return
+		}
+
+		if !dup.enterDir(path, fi, t.root.dev) {
+			return
+		}
+	}
+
+	w.pending.Add(1)
+	w.dirs <- t
+}
+
+// Walks the provided directory on an idle goroutine, or on the calling one if all are busy.
+func (w *walker) walk(t dirTask) {
+	w.pending.Add(1)
+	select {
+	case w.dirs <- t:
+	default:
+		w.walkDir(t)
+		w.pending.Done()
+	}
+}
+
+// Waits until all directories are walked and returns the error that stopped the walk, if any.
+func (w *walker) wait() error {
+	w.pending.Wait()
+	close(w.dirs)
+	return w.err
+}
+
+// Records the provided error, if any, and stops the walk.
+func (w *walker) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	w.errOnce.Do(func() {
+		w.err = err
+		w.failed.Store(true)
+	})
+}
+
+// Reads the entries of the provided directory in batches and handles its files right away.
+//
+// Subdirectories and symlinks are only handled once the directory is closed, so that at
+// most one directory is open per goroutine.
+func (w *walker) walkDir(t dirTask) {
+	dup := w.dup
+	if dup.shuttingDown() || w.failed.Load() {
+		return
+	}
+
+	dir, err := os.Open(t.dir)
+	if err != nil {
+		w.fail(dup.errs.recover(t.path, OpWalk, err))
+		return
+	}
+
+	// Watched before reading, so that files created meanwhile aren't missed.
+	if dup.watcher != nil {
+		dup.watcher.watchDir(t)
+	}
+
+	var later []fs.DirEntry
+	for {
+		entries, err := dir.ReadDir(readDirBatch)
+		for _, de := range entries {
+			if de.IsDir() || de.Type()&fs.ModeSymlink != 0 {
+				later = append(later, de)
+				continue
+			}
+
+			if err := dup.visitFile(t, de); err != nil {
+				w.fail(err)
+				dir.Close()
+				return
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Entries read so far are still searched.
+			w.fail(dup.errs.recover(t.path, OpWalk, err))
+			break
+		}
+	}
+	dir.Close()
+
+	for _, de := range later {
+		if dup.shuttingDown() || w.failed.Load() {
+			return
+		}
+
+		child := t.child(de.Name())
+		if !de.IsDir() {
+			if dup.filters.FollowSymlinks {
+				w.fail(dup.followSymlink(child))
+			}
+			continue
+		}
+
+		if dup.filters.skipDir(child.path, t.root.path) {
+			continue
+		}
+
+		if dup.filters.FollowSymlinks || dup.filters.filtersFilesystems() {
+			fi, err := de.Info()
+			if err != nil {
+				w.fail(dup.errs.recover(child.path, OpStat, err))
+				continue
+			}
+
+			if !dup.enterDir(child.path, fi, t.root.dev) {
+				continue
+			}
+		}
+
+		w.walk(child)
+	}
+}
+
+// Reports whether the directory with the provided file info should be walked based on the
+// filesystem filters, and whether it was already visited when following symlinks.
+func (dup *dupescout) enterDir(path string, fi fs.FileInfo, rootDev uint64) bool {
+	if dup.skipFilesystem(path, fi, rootDev) {
+		return false
+	}
+
+	return !dup.filters.FollowSymlinks || !dup.symlinks.visited(fi)
+}
+
+// Adds the provided entry of the directory to the search if it's a regular file that
+// passes the filters.
+func (dup *dupescout) visitFile(t dirTask, de fs.DirEntry) error {
+	path := filepath.Join(t.path, de.Name())
+	if !de.Type().IsRegular() || dup.filters.skipFile(path, t.root.path) {
+		return nil
+	}
+
+	fi, err := de.Info()
+	if err != nil {
+		return dup.errs.recover(path, OpStat, err)
+	}
+
+	if dup.filters.skipSize(fi.Size()) {
+		return nil
+	}
+
+	// Files inside a symlinked directory may also be found through other symlinks.
+	f := newFile(path, fi)
+	f.Root = t.root.path
+	f.Reference = t.root.reference
+	if f.Inode != 0 && (fileLinks(fi) > 1 || t.linked()) && dup.links.seen(f) {
+		return nil // Another path of the same inode was already found.
+	}
+
+	dup.addFile(f)
+	return nil
+}
@@ -0,0 +1,203 @@
+package dupescout
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Helper to create a synthetic tree of the provided depth, where every directory holds
+// `files` files and `dirs` subdirectories. Returns the root and the number of files.
+func createSyntheticTree(tb testing.TB, depth, dirs, files int) (string, int) {
+	tb.Helper()
+	root := tb.TempDir()
+	total := 0
+
+	var create func(dir string, depth int)
+	create = func(dir string, depth int) {
+		for i := 0; i < files; i++ {
+			// Files come in pairs with the same contents, so half of them are duplicates.
+			content := fmt.Sprintf("%s/%d", strings.TrimPrefix(dir, root), i/2)
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.txt", i)), []byte(content), 0o644); err != nil {
+				tb.Fatal(err)
+			}
+			total++
+		}
+
+		if depth == 0 {
+			return
+		}
+
+		for i := 0; i < dirs; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("d%d", i))
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				tb.Fatal(err)
+			}
+			create(sub, depth-1)
+		}
+	}
+
+	create(root, depth)
+	return root, total
+}
+
+// Helper to run a search that only collects the files found by the walker.
+func walkFiles(tb testing.TB, cfg Cfg) []File {
+	tb.Helper()
+	cfg.defaults()
+
+	dup := newDupeScout(context.Background(), cfg)
+	dup.staged = true // Keeps the files in the size buckets instead of hashing them.
+	dup.walker = dup.startWalker(cfg.Walkers)
+
+	for _, path := range cfg.Paths {
+		dup.walker.walkRoot(path, false)
+	}
+
+	if err := dup.walker.wait(); err != nil {
+		tb.Fatal(err)
+	}
+
+	var files []File
+	dup.sizes.(*buckets).m.Range(func(_ string, bucket []File) bool {
+		files = append(files, bucket...)
+		return true
+	})
+	return files
+}
+
+func TestWalkerFindsAllFiles(t *testing.T) {
+	root, total := createSyntheticTree(t, 3, 4, 5)
+
+	for _, walkers := range []int{1, 2, DefaultWalkers} {
+		files := walkFiles(t, Cfg{Paths: []string{root}, Walkers: walkers})
+		if len(files) != total {
+			t.Errorf("Expected %d files with %d walkers, got %d", total, walkers, len(files))
+		}
+	}
+}
+
+func TestWalkerSkipDir(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt":                  "Hello, World!",
+		"sub/b.txt":              "Hello, World!",
+		"node_modules/c.txt":     "Hello, World!",
+		"sub/node_modules/d.txt": "Hello, World!",
+		".git/e.txt":             "Hello, World!",
+	})
+
+	files := walkFiles(t, Cfg{Paths: []string{dir}, Filters: Filters{DirsExclude: []string{"node_modules"}}})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"a.txt", "b.txt"}) {
+		t.Errorf("Expected [a.txt b.txt], got %v", names)
+	}
+
+	// The searched path itself is never skipped, even if it matches the dir filters.
+	files = walkFiles(t, Cfg{Paths: []string{dir}, Filters: Filters{SkipSubdirs: true}})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"a.txt"}) {
+		t.Errorf("Expected [a.txt] when skipping subdirs, got %v", names)
+	}
+
+	files = walkFiles(t, Cfg{Paths: []string{filepath.Join(dir, ".git")}})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"e.txt"}) {
+		t.Errorf("Expected [e.txt] when searching a hidden dir, got %v", names)
+	}
+}
+
+func TestWalkerGlobs(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"Movies/a.mkv":               "Hello, World!",
+		"Movies/Alien/Extras/b.mkv":  "Hello, World!",
+		"Shows/Lost/Season 1/c.mkv":  "Hello, World!",
+		"Shows/Lost/Season 1/c.srt":  "Hello, World!",
+		"Shows/Other/Season 1/d.mkv": "Hello, World!",
+	})
+
+	filters := Filters{GlobInclude: []string{"**/*.mkv"}, GlobExclude: []string{"Movies/**/Extras"}}
+	files := walkFiles(t, Cfg{Paths: []string{dir}, Filters: filters})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"a.mkv", "c.mkv", "d.mkv"}) {
+		t.Errorf("Expected [a.mkv c.mkv d.mkv], got %v", names)
+	}
+
+	// Patterns are relative to the searched path.
+	filters = Filters{GlobInclude: []string{"Lost/**"}}
+	files = walkFiles(t, Cfg{Paths: []string{filepath.Join(dir, "Shows")}, Filters: filters})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"c.mkv", "c.srt"}) {
+		t.Errorf("Expected [c.mkv c.srt], got %v", names)
+	}
+}
+
+func TestWalkerSizes(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"small.txt":  "Go!",
+		"medium.txt": "Hello, World!",
+		"large.txt":  strings.Repeat("Hello, World!", 100),
+	})
+
+	filters := Filters{MinSize: 10, MaxSize: 1 << 10}
+	files := walkFiles(t, Cfg{Paths: []string{dir}, Filters: filters})
+	if names := baseNames(files); !reflect.DeepEqual(names, []string{"medium.txt"}) {
+		t.Errorf("Expected [medium.txt], got %v", names)
+	}
+}
+
+// Walks the tree like the search did before the parallel walker, with a single
+// filepath.WalkDir per searched path.
+func walkDirBaseline(tb testing.TB, dup *dupescout, root string) {
+	r := &searchRoot{path: root}
+	err := filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if de.IsDir() {
+			if path != root && dup.filters.skipDir(path, root) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return dup.visitFile(dirTask{filepath.Dir(path), filepath.Dir(path), r}, de)
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	for _, tree := range []struct {
+		name               string
+		depth, dirs, files int
+	}{
+		{"wide", 1, 200, 50},
+		{"deep", 6, 3, 10},
+	} {
+		root, total := createSyntheticTree(b, tree.depth, tree.dirs, tree.files)
+		cfg := Cfg{Paths: []string{root}}
+		cfg.defaults()
+
+		b.Run(tree.name+"/WalkDir", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dup := newDupeScout(context.Background(), cfg)
+				dup.staged = true
+				walkDirBaseline(b, dup, root)
+			}
+			b.ReportMetric(float64(total), "files/op")
+		})
+
+		for _, walkers := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("%s/walkers=%d", tree.name, walkers), func(b *testing.B) {
+				cfg := cfg
+				cfg.Walkers = walkers
+				for i := 0; i < b.N; i++ {
+					walkFiles(b, cfg)
+				}
+				b.ReportMetric(float64(total), "files/op")
+			})
+		}
+	}
+}
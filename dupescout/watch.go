@@ -0,0 +1,441 @@
+package dupescout
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+type WatchEventKind int
+
+const (
+	GroupFormed WatchEventKind = iota // A file duplicates a file that had no duplicates so far, forming a new group.
+	FileJoined                        // A file joined an existing group of duplicates.
+	WatchFailed                       // A path couldn't be watched or searched, see WatchEvent.Err.
+)
+
+// Describes a file that turned out to be a duplicate while watching, see Watch.
+type WatchEvent struct {
+	Kind  WatchEventKind
+	Group int        // ID of the group, following the IDs of the groups of the initial search.
+	Key   string     // Key of the group.
+	File  File       // File that was written, modified or moved into a watched directory.
+	Files []File     // All files of the group, including File.
+	Err   *ScanError // Error of the path that couldn't be watched or searched, only set for WatchFailed.
+}
+
+var errWatchOverflow = errors.New("too many changes at once, some of them were dropped")
+
+// Searches for duplicates like GetGroups, then keeps watching the searched directories and
+// searches files as they are written, modified or moved into them. An event is sent whenever
+// such a file turns out to be a duplicate of a file found before.
+//
+// Blocks until the initial search is complete and returns its groups along with the channel
+// of events, which is closed once the provided context is cancelled. ScanErrors of the initial
+// search are sent as the first WatchFailed events, so an error is only returned if the search
+// or watching couldn't be started at all.
+//
+// Watching relies on inotify and is only supported on Linux. Every file needs a key to compare
+// new files with, so Cfg.Staged and Cfg.MemoryLimit are ignored. Symlinks created while
+// watching are not followed.
+func Watch(ctx context.Context, c Cfg) ([]Group, <-chan WatchEvent, error) {
+	c.Staged = false
+	c.MemoryLimit = 0
+
+	n, err := newNotifier()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pathErrs, err := c.defaults()
+	if err == nil {
+		err = c.Snapshot.begin(c.CacheNamespace, c.Staged)
+	}
+	if err != nil {
+		n.close()
+		return nil, nil, err
+	}
+
+	dup := newDupeScout(ctx, c)
+	dup.errs.errs = append(dup.errs.errs, pathErrs...)
+
+	w := &watcher{
+		dup:      dup,
+		notifier: n,
+		walkers:  c.Walkers,
+		dirs:     map[int]dirTask{},
+		dirKeys:  map[int]string{},
+		files:    map[string]File{},
+		events:   make(chan WatchEvent, c.Workers),
+		updates:  make(chan GroupUpdate, 1),
+	}
+	dup.watcher = w
+
+	updates := make(chan GroupUpdate, 10)
+	collected := make(chan []Group)
+	go func() {
+		var groups []Group
+		for u := range updates {
+			groups = u.apply(groups)
+		}
+		collected <- groups
+	}()
+
+	err = dup.search(c, updates)
+	groups := <-collected
+	if err != nil {
+		n.close()
+		return groups, nil, err
+	}
+
+	// Files searched from now on are not part of the snapshot of the initial search.
+	dup.snapshot = nil
+
+	dup.groups.Range(func(_ string, groups []*group) bool {
+		for _, g := range groups {
+			for _, f := range g.files {
+				w.files[f.Path] = f
+			}
+		}
+		return true
+	})
+
+	scanErrs := dup.errs.errs
+	dup.errs.report = w.fail
+
+	// A file that can't be hashed only fails itself while watching, never the watch.
+	dup.pairs = make(chan *pair, c.Workers)
+	dup.hashers = newDevicePools(c.Workers, c.DeviceWorkers, c.RotationalReaders, func(f File) error {
+		if err := dup.producePair(f); err != nil {
+			dup.errs.add(f.Path, OpKey, err)
+		}
+		return nil
+	})
+
+	go w.run(scanErrs)
+	return groups, w.events, nil
+}
+
+// Platform specific notifications of changes in the watched directories.
+type notifier interface {
+	add(dir string) (int, error)   // Starts watching the provided directory and returns its watch descriptor.
+	remove(wd int) error           // Stops watching the directory of the provided watch descriptor.
+	read() ([]notification, error) // Blocks until changes arrive, fails once closed.
+	close() error
+}
+
+type notifyOp int
+
+const (
+	opWritten  notifyOp = iota // A file was written and closed, or moved into the directory.
+	opDirAdded                 // A directory was created or moved into the directory.
+	opRemoved                  // A file or directory was deleted or moved out of the directory.
+	opIgnored                  // The directory itself is no longer watched, e.g. because it was deleted.
+	opOverflow                 // Changes were dropped because they weren't read fast enough.
+)
+
+// A change in a watched directory.
+type notification struct {
+	wd   int      // Watch descriptor of the directory, see notifier.add.
+	name string   // Name of the changed entry, empty for opIgnored and opOverflow.
+	dir  bool     // Whether the changed entry is a directory.
+	op   notifyOp // Kind of change.
+}
+
+// Keeps the groups of a search up to date with the changes in its directories.
+//
+// Notifications are handled one at a time by a single goroutine, which hands the files
+// over to the hashers. The pairs they produce are consumed by another goroutine, which
+// adds them to their groups and sends the resulting events.
+type watcher struct {
+	dup      *dupescout
+	notifier notifier
+	walkers  int // number of goroutines walking new directories
+
+	dirsMu  sync.Mutex
+	dirs    map[int]dirTask // watch descriptor -> watched directory
+	dirKeys map[int]string  // watch descriptor -> visited key of the directory, only when following symlinks
+
+	mu      sync.Mutex
+	files   map[string]File  // path -> hashed file, to remove it from its group once it changes
+	events  chan WatchEvent  // closed once watching stops
+	updates chan GroupUpdate // update of the last consumed pair, if any
+}
+
+// Starts watching the provided directory, which is called by the walker for every directory.
+func (w *watcher) watchDir(t dirTask) {
+	wd, err := w.notifier.add(t.dir)
+	if err != nil {
+		w.dup.errs.add(t.path, OpWatch, err)
+		return
+	}
+
+	key := ""
+	if w.dup.filters.FollowSymlinks {
+		if fi, err := os.Stat(t.dir); err == nil {
+			key = dirKey(fi)
+		}
+	}
+
+	w.dirsMu.Lock()
+	defer w.dirsMu.Unlock()
+	w.dirs[wd] = t
+	if key != "" {
+		w.dirKeys[wd] = key
+	}
+}
+
+// Stops tracking the directory of the provided watch descriptor, w.dirsMu must be held.
+//
+// The directory is also forgotten as visited, so that it's walked again if it's moved
+// into a watched directory.
+func (w *watcher) unwatch(wd int) {
+	delete(w.dirs, wd)
+	if key, ok := w.dirKeys[wd]; ok {
+		w.dup.symlinks.forget(key)
+		delete(w.dirKeys, wd)
+	}
+}
+
+// Sends the provided errors, then handles notifications until the context is cancelled.
+func (w *watcher) run(scanErrs []*ScanError) {
+	dup := w.dup
+	for _, e := range scanErrs {
+		w.fail(e)
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		for p := range dup.pairs {
+			if ev, ok := w.add(p); ok {
+				w.send(ev)
+			}
+		}
+		close(consumed)
+	}()
+
+	// Closing the notifier unblocks the pending read.
+	stop := context.AfterFunc(dup.ctx, func() { w.notifier.close() })
+
+	for {
+		ns, err := w.notifier.read()
+		if err != nil {
+			if dup.ctx.Err() == nil {
+				w.fail(&ScanError{Op: OpWatch, Err: err})
+			}
+			break
+		}
+
+		for _, n := range ns {
+			w.handle(n)
+		}
+	}
+
+	if stop() {
+		w.notifier.close()
+	}
+
+	dup.hashers.wait() // Never fails, see Watch.
+	close(dup.pairs)
+	<-consumed
+	close(w.events)
+}
+
+// Sends the provided event, unless watching is being stopped.
+func (w *watcher) send(ev WatchEvent) {
+	select {
+	case w.events <- ev:
+	case <-w.dup.ctx.Done():
+	}
+}
+
+// Sends the provided error as a WatchFailed event.
+func (w *watcher) fail(e *ScanError) {
+	w.send(WatchEvent{Kind: WatchFailed, Err: e})
+}
+
+func (w *watcher) handle(n notification) {
+	if n.op == opOverflow {
+		w.fail(&ScanError{Op: OpWatch, Err: errWatchOverflow})
+		return
+	}
+
+	w.dirsMu.Lock()
+	t, ok := w.dirs[n.wd]
+	if n.op == opIgnored {
+		w.unwatch(n.wd)
+	}
+	w.dirsMu.Unlock()
+
+	if !ok {
+		return // Dropped along with a removed directory.
+	}
+
+	switch n.op {
+	case opWritten:
+		w.written(t, n.name)
+	case opDirAdded:
+		w.dirAdded(t, t.child(n.name))
+	case opRemoved:
+		w.removed(t.child(n.name).path, n.dir)
+	}
+}
+
+// Searches the provided entry of the directory, unless it's unchanged since it was hashed.
+func (w *watcher) written(t dirTask, name string) {
+	dup := w.dup
+	path := filepath.Join(t.path, name)
+
+	fi, err := os.Lstat(filepath.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return // Already gone again, which is handled by its own notification.
+	}
+	if err != nil {
+		dup.errs.add(path, OpStat, err)
+		return
+	}
+
+	w.mu.Lock()
+	prev, ok := w.files[path]
+	w.mu.Unlock()
+
+	if ok && prev.unchanged(newFile(path, fi)) {
+		return // e.g. written while the initial search was in progress.
+	}
+
+	// Modified files may no longer belong to their group, or no longer pass the filters.
+	w.removed(path, false)
+
+	if err := dup.visitFile(t, fs.FileInfoToDirEntry(fi)); err != nil {
+		dup.errs.add(path, OpStat, err)
+	}
+}
+
+// Walks the provided new directory if it passes the filters, watching it and its subdirectories.
+func (w *watcher) dirAdded(parent, t dirTask) {
+	dup := w.dup
+	if dup.filters.skipDir(t.path, t.root.path) {
+		return
+	}
+
+	if dup.filters.FollowSymlinks || dup.filters.filtersFilesystems() {
+		fi, err := os.Stat(t.dir)
+		if err != nil {
+			if err := dup.errs.recover(t.path, OpStat, err); err != nil {
+				dup.errs.add(t.path, OpStat, err)
+			}
+			return
+		}
+
+		if !dup.enterDir(t.path, fi, parent.root.dev) {
+			return
+		}
+	}
+
+	dup.walker = dup.startWalker(w.walkers)
+	dup.walker.walk(t)
+	if err := dup.walker.wait(); err != nil {
+		dup.errs.add(t.path, OpWalk, err)
+	}
+}
+
+// Removes the file of the provided path from its group, or all files and watches of the
+// directory of the provided path.
+func (w *watcher) removed(path string, dir bool) {
+	if dir {
+		w.dirsMu.Lock()
+		for wd, t := range w.dirs {
+			if insideRoots(t.path, []string{path}) {
+				w.notifier.remove(wd) // Fails if the directory is already gone, which drops the watch anyway.
+				w.unwatch(wd)
+			}
+		}
+		w.dirsMu.Unlock()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !dir {
+		if f, ok := w.files[path]; ok {
+			w.remove(f)
+		}
+		return
+	}
+
+	for p, f := range w.files {
+		if insideRoots(p, []string{path}) {
+			w.remove(f)
+		}
+	}
+}
+
+// Removes the provided file from its group, w.mu must be held.
+func (w *watcher) remove(f File) {
+	dup := w.dup
+	delete(w.files, f.Path)
+	dup.links.forget(f)
+
+	groups, _ := dup.groups.Load(f.Key)
+	kept := groups[:0:0]
+	for _, g := range groups {
+		// Copied, since the files of the group may have been sent along with its updates.
+		n := len(g.files)
+		g.files = slices.DeleteFunc(slices.Clone(g.files), func(gf File) bool { return gf.Path == f.Path })
+		g.created = g.created && dup.complete(g) // Formed anew once complete again.
+
+		if len(g.files) < n {
+			// New files of the variant are compared with one of its remaining files instead.
+			path := ""
+			if len(g.files) > 0 {
+				path = g.files[0].Path
+			}
+			dup.verifier.replace(f.Key, g.variant, path)
+		}
+		if len(g.files) > 0 {
+			kept = append(kept, g)
+		}
+	}
+
+	if len(kept) == 0 {
+		dup.groups.Delete(f.Key)
+		return
+	}
+	dup.groups.Store(f.Key, kept)
+}
+
+// Adds the file of the provided pair to its group, and returns the resulting event if it
+// formed or joined a group of duplicates.
+func (w *watcher) add(p *pair) (WatchEvent, bool) {
+	dup := w.dup
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if prev, ok := w.files[p.file.Path]; ok {
+		if prev.unchanged(p.file) {
+			return WatchEvent{}, false // Hashed twice, e.g. when written twice in a row.
+		}
+		w.remove(prev)
+	}
+
+	groups, _ := dup.groups.Load(p.key)
+	groups, g := dup.consume(groups, p, w.updates)
+	dup.groups.Store(p.key, groups)
+	w.files[p.file.Path] = p.file
+
+	select {
+	case u := <-w.updates:
+		kind := FileJoined
+		if u.Kind == GroupCreated {
+			kind = GroupFormed
+		}
+		return WatchEvent{Kind: kind, Group: u.Group, Key: u.Key, File: p.file, Files: slices.Clone(g.files)}, true
+	default:
+		return WatchEvent{}, false // No duplicates yet.
+	}
+}
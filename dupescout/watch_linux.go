@@ -0,0 +1,115 @@
+package dupescout
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Changes that are watched in every directory.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// Notifier backed by inotify, whose descriptor is non-blocking so that reads go through
+// the runtime poller and are unblocked by closing the file.
+type inotify struct {
+	file *os.File
+	conn syscall.RawConn // to use the descriptor without racing with close
+	buf  []byte
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), "inotify")
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &inotify{
+		file: file,
+		conn: conn,
+		buf:  make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)),
+	}, nil
+}
+
+func (n *inotify) add(dir string) (int, error) {
+	var wd int
+	var err error
+	cerr := n.conn.Control(func(fd uintptr) {
+		wd, err = syscall.InotifyAddWatch(int(fd), dir, inotifyMask)
+	})
+	if cerr != nil {
+		return 0, cerr
+	}
+	return wd, os.NewSyscallError("inotify_add_watch", err)
+}
+
+func (n *inotify) remove(wd int) error {
+	var err error
+	cerr := n.conn.Control(func(fd uintptr) {
+		_, err = syscall.InotifyRmWatch(int(fd), uint32(wd))
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return os.NewSyscallError("inotify_rm_watch", err)
+}
+
+func (n *inotify) read() ([]notification, error) {
+	size, err := n.file.Read(n.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns []notification
+	for off := 0; off+syscall.SizeofInotifyEvent <= size; {
+		wd := int32(binary.NativeEndian.Uint32(n.buf[off:]))
+		mask := binary.NativeEndian.Uint32(n.buf[off+4:])
+		nameLen := int(binary.NativeEndian.Uint32(n.buf[off+12:]))
+
+		off += syscall.SizeofInotifyEvent
+		name := strings.TrimRight(string(n.buf[off:off+nameLen]), "\x00") // Padded with NULs.
+		off += nameLen
+
+		if op, ok := inotifyOp(mask); ok {
+			ns = append(ns, notification{wd: int(wd), name: name, dir: mask&syscall.IN_ISDIR != 0, op: op})
+		}
+	}
+
+	return ns, nil
+}
+
+func (n *inotify) close() error {
+	return n.file.Close()
+}
+
+// Returns the operation of the provided inotify event mask, if it's of interest.
+//
+// Files are only searched once they are closed after writing, since they are usually
+// still being written when created.
+func inotifyOp(mask uint32) (notifyOp, bool) {
+	dir := mask&syscall.IN_ISDIR != 0
+
+	switch {
+	case mask&syscall.IN_Q_OVERFLOW != 0:
+		return opOverflow, true
+	case mask&syscall.IN_IGNORED != 0:
+		return opIgnored, true
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		return opRemoved, true
+	case dir && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		return opDirAdded, true
+	case !dir && mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+		return opWritten, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,130 @@
+package dupescout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Helper to receive the next event, failing the test if none arrives in time.
+func nextEvent(t *testing.T, events <-chan WatchEvent) WatchEvent {
+	t.Helper()
+
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event, but the channel was closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+
+	return WatchEvent{}
+}
+
+func TestWatch(t *testing.T) {
+	dir := createTempTree(t, map[string]string{
+		"a.txt": "Hello, World!",
+		"b.txt": "Go rocks!",
+	})
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	groups, events, err := Watch(ctx, Cfg{Paths: []string{dir}, Filters: Filters{ExtExclude: []string{".tmp"}, FollowSymlinks: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Fatalf("Expected no groups in the initial search, got %v", groups)
+	}
+
+	write("c.txt", "Hello, World!")
+	ev := nextEvent(t, events)
+	if ev.Kind != GroupFormed || ev.Group != 0 || filepath.Base(ev.File.Path) != "c.txt" {
+		t.Errorf("Expected c.txt to form group 0, got %+v", ev)
+	}
+	if names := baseNames(ev.Files); !reflect.DeepEqual(names, []string{"a.txt", "c.txt"}) {
+		t.Errorf("Expected [a.txt c.txt], got %v", names)
+	}
+
+	// Files in new directories are searched as well.
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("sub/d.txt", "Hello, World!")
+	ev = nextEvent(t, events)
+	if ev.Kind != FileJoined || ev.Group != 0 || filepath.Base(ev.File.Path) != "d.txt" {
+		t.Errorf("Expected d.txt to join group 0, got %+v", ev)
+	}
+	if names := baseNames(ev.Files); !reflect.DeepEqual(names, []string{"a.txt", "c.txt", "d.txt"}) {
+		t.Errorf("Expected [a.txt c.txt d.txt], got %v", names)
+	}
+
+	// Removed files leave their group, and filtered files are never searched.
+	for _, name := range []string{"c.txt", "sub/d.txt"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("e.tmp", "Go rocks!")
+	write("f.txt", "Go rocks!")
+	ev = nextEvent(t, events)
+	if ev.Kind != GroupFormed || ev.Group != 1 || filepath.Base(ev.File.Path) != "f.txt" {
+		t.Errorf("Expected f.txt to form group 1, got %+v", ev)
+	}
+	if names := baseNames(ev.Files); !reflect.DeepEqual(names, []string{"b.txt", "f.txt"}) {
+		t.Errorf("Expected [b.txt f.txt], got %v", names)
+	}
+
+	// A modified file is compared with its new contents.
+	write("a.txt", "Go rocks!")
+	ev = nextEvent(t, events)
+	if ev.Kind != FileJoined || ev.Group != 1 || filepath.Base(ev.File.Path) != "a.txt" {
+		t.Errorf("Expected a.txt to join group 1, got %+v", ev)
+	}
+
+	// Renamed directories are searched and watched again under their new path, even
+	// though they were already visited when following symlinks.
+	if err := os.Mkdir(filepath.Join(dir, "d1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("d1/g.txt", "Go rocks!")
+	ev = nextEvent(t, events)
+	if ev.Kind != FileJoined || ev.Group != 1 || filepath.Base(ev.File.Path) != "g.txt" {
+		t.Errorf("Expected g.txt to join group 1, got %+v", ev)
+	}
+	if err := os.Rename(filepath.Join(dir, "d1"), filepath.Join(dir, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Kind != FileJoined || ev.File.Path != filepath.Join(dir, "moved", "g.txt") {
+		t.Errorf("Expected moved/g.txt to join group 1, got %+v", ev)
+	}
+	write("moved/h.txt", "Go rocks!")
+	ev = nextEvent(t, events)
+	if ev.Kind != FileJoined || ev.File.Path != filepath.Join(dir, "moved", "h.txt") {
+		t.Errorf("Expected moved/h.txt to join group 1, got %+v", ev)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the events channel to be closed once cancelled")
+	}
+}
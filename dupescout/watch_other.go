@@ -0,0 +1,10 @@
+//go:build !linux
+
+package dupescout
+
+import "errors"
+
+// Watching relies on inotify, so it's only supported on Linux.
+func newNotifier() (notifier, error) {
+	return nil, errors.New("watching is only supported on Linux")
+}